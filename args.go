@@ -1,32 +1,252 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
+	enbypub "github.com/ironiridis/enbypub/enbypublib"
 )
 
+// BuildCmd generates the site. It's the default when no command is given.
+type BuildCmd struct{}
+
+// NewCmd creates a new Text in the content folder from an archetype.
+type NewCmd struct {
+	Title      string   `arg:"positional,required" help:"Title of the new text"`
+	Tags       []string `arg:"--tags" placeholder:"TAG" help:"Tags for the new text, separated by spaces or commas"`
+	Template   string   `arg:"--template" placeholder:"NAME" help:"Template for the new text [default: from its feed, or page.html]"`
+	Archetypes string   `arg:"--archetypes" placeholder:"DIR" help:"Archetypes for new texts are found in this folder relative to root [default: archetypes]"`
+	Edit       bool     `arg:"--edit,-e" help:"Open the new text with $VISUAL or $EDITOR"`
+}
+
+// CheckCmd loads everything a build would and reports problems without writing any output.
+type CheckCmd struct {
+	JSON bool `arg:"--json" help:"Report problems as JSON"`
+}
+
+// ServeCmd builds the site and serves the public folder over HTTP.
+type ServeCmd struct {
+	Listen  string `arg:"--listen,-l" default:"localhost:8080" placeholder:"ADDR" help:"Address to listen on"`
+	NoBuild bool   `arg:"--nobuild" help:"Serve the public folder as it is, without building first"`
+}
+
+// ListCmd lists the Texts in the content folder and where each is published.
+type ListCmd struct {
+	Tags     []string `arg:"--tag" placeholder:"TAG" help:"Only list texts with any of these tags"`
+	Feeds    []string `arg:"--feed" placeholder:"FEED" help:"Only list texts published in any of these feeds (by slug)"`
+	Since    *date    `arg:"--since" placeholder:"DATE" help:"Only list texts created on or after this date (YYYY-MM-DD in the site timezone, or RFC 3339)"`
+	Until    *date    `arg:"--until" placeholder:"DATE" help:"Only list texts created on or before this date (YYYY-MM-DD in the site timezone, or RFC 3339)"`
+	Drafts   bool     `arg:"--drafts" help:"Only list drafts (texts tagged draft, or with draft: true)"`
+	NoDrafts bool     `arg:"--nodrafts" help:"Leave drafts out"`
+	Format   string   `arg:"--format" default:"table" placeholder:"FORMAT" help:"Output format: table, json or csv"`
+}
+
+// QueryCmd lists the Texts that satisfy a match expression, like a Feed match.
+type QueryCmd struct {
+	Match string `arg:"positional,required" placeholder:"EXPR" help:"Match expression, eg 'public AND NOT draft' or 'lang == \"de\"'"`
+	ListCmd
+
+	// match is parsed from Match by parseArgs
+	match *enbypub.Match
+}
+
+// date is a flag value that accepts a date or an RFC 3339 time. A date is in the site timezone,
+// which isn't known until the site configuration is read, so setup parses it again then.
+type date struct {
+	time.Time
+
+	// day is set if only a date was given, so the whole day is meant
+	day bool
+
+	raw string
+}
+
+func (d *date) UnmarshalText(b []byte) error {
+	d.raw = string(b)
+	return d.parse(time.UTC)
+}
+
+// parse sets d from the text it was given, reading a date as midnight in loc.
+func (d *date) parse(loc *time.Location) error {
+	if t, err := time.ParseInLocation(time.DateOnly, d.raw, loc); err == nil {
+		d.Time, d.day = t, true
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, d.raw)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q as YYYY-MM-DD or an RFC 3339 time", d.raw)
+	}
+	d.Time, d.day = t, false
+	return nil
+}
+
+// CleanCmd removes generated output.
+type CleanCmd struct {
+	All bool `arg:"--all" help:"Also remove the processed image cache"`
+}
+
+// EjectCmd writes the embedded default theme into the templates folder.
+type EjectCmd struct {
+	Force bool `arg:"--force" help:"Overwrite templates that already exist"`
+}
+
 var args struct {
-	Root            string         `arg:"--root,-d" default:"." placeholder:"DIR" help:"Base folder to work in"`
-	PublicDir       string         `arg:"--pub,-p" default:"public" placeholder:"DIR" help:"Generated content is created in this folder relatve to root"`
-	ContentDir      string         `arg:"--content,-c" default:"content" placeholder:"DIR" help:"Content is generated from files in this folder relative to root"`
-	TemplatesDir    string         `arg:"--templates,-t" default:"templates" placeholder:"DIR" help:"Template HTML files are loaded from this folder relative to root"`
-	AssetsDir       string         `arg:"--assets,-a" default:"assets" placeholder:"DIR" help:"Assets in this folder relative to root are copied to the public folder into a directory named assets"`
-	TextFilePattern *regexp.Regexp `arg:"--textfilepattern" default:"\\.md$" placeholder:"REGEX" help:"A regular expression for matching Text files relative to the content dir"`
-	FeedsYaml       string         `arg:"--feeds,-f" default:"_feeds.yaml" placeholder:"FILE" help:"File relative to root where feeds are defined"`
+	Build *BuildCmd `arg:"subcommand:build" help:"Generate the site (the default)"`
+	New   *NewCmd   `arg:"subcommand:new" help:"Create a new text"`
+	Check *CheckCmd `arg:"subcommand:check" help:"Report problems with the site without generating it"`
+	Serve *ServeCmd `arg:"subcommand:serve" help:"Generate the site and serve it over HTTP"`
+	List  *ListCmd  `arg:"subcommand:list" help:"List texts and where they're published"`
+	Query *QueryCmd `arg:"subcommand:query" help:"List texts that satisfy a match expression"`
+	Clean *CleanCmd `arg:"subcommand:clean" help:"Remove generated files"`
+	Eject *EjectCmd `arg:"subcommand:eject" help:"Write the default theme templates into the templates folder for customization"`
+
+	Config          string                  `arg:"--config" placeholder:"FILE" help:"Site configuration file relative to root; settings given as flags override it [default: enbypub.yaml, if it exists]"`
+	Root            string                  `arg:"--root,-d" default:"." placeholder:"DIR" help:"Base folder to work in"`
+	PublicDir       string                  `arg:"--pub,-p" placeholder:"DIR" help:"Generated content is created in this folder relative to root [default: public]"`
+	ContentDir      string                  `arg:"--content,-c" placeholder:"DIR" help:"Content is generated from files in this folder relative to root [default: content]"`
+	TemplatesDir    string                  `arg:"--templates,-t" placeholder:"DIR" help:"Template HTML files are loaded from this folder and its subfolders relative to root [default: templates]"`
+	AssetsDir       string                  `arg:"--assets,-a" placeholder:"DIR" help:"Assets in this folder relative to root are copied to the public folder into a directory named assets [default: assets]"`
+	TextFilePattern *regexp.Regexp          `arg:"--textfilepattern" placeholder:"REGEX" help:"A regular expression for matching Text files relative to the content dir [default: \\.md$]"`
+	AllFormats      bool                    `arg:"--allformats" help:"Read Texts from every format with a renderer (.md, .markdown, .txt, .html, .htm and .gmi) unless --textfilepattern is given"`
+	FeedsYaml       string                  `arg:"--feeds,-f" placeholder:"FILE" help:"File relative to root where feeds are defined [default: _feeds.yaml]"`
+	BaseURL         *url.URL                `arg:"--baseurl,-u" placeholder:"URL" help:"The public URL of the published site, used for absolute links"`
+	Collisions      enbypub.CollisionPolicy `arg:"--collisions" placeholder:"POLICY" help:"What to do when texts would be published at the same path: error, suffix (append -2, -3...) or priority (the feed with the highest priority wins) [default: error]"`
+	CacheDir        string                  `arg:"--cache" placeholder:"DIR" help:"Processed images are cached in this folder relative to root between builds [default: .enbypub-cache]"`
+	Verbose         bool                    `arg:"--verbose,-v" help:"Report each file as it's generated"`
+	Quiet           bool                    `arg:"--quiet,-q" help:"Only report errors"`
 }
 
 var rootDir fs.FS
 
-func init() {
-	arg.MustParse(&args)
+// site is the site configuration, with the settings given as flags applied.
+var site *enbypub.SiteConfig
+
+// errUsage is returned by parseArgs when the command line is invalid; the usage has already been
+// written.
+var errUsage = errors.New("invalid arguments")
+
+// parseArgs parses argv into args. It returns arg.ErrHelp if help was requested and written.
+func parseArgs(argv []string) (*arg.Parser, error) {
+	p, err := arg.NewParser(arg.Config{Program: "enbypub"}, &args)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build argument parser: %w", err)
+	}
+	switch err := p.Parse(argv); {
+	case errors.Is(err, arg.ErrHelp):
+		p.WriteHelpForSubcommand(os.Stdout, p.SubcommandNames()...)
+		return p, err
+	case err != nil:
+		p.WriteUsageForSubcommand(os.Stderr, p.SubcommandNames()...)
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return p, errUsage
+	}
+	for _, l := range []*ListCmd{args.List, queryList()} {
+		if l != nil && !slices.Contains(listFormats, l.Format) {
+			p.WriteUsageForSubcommand(os.Stderr, p.SubcommandNames()...)
+			fmt.Fprintf(os.Stderr, "error: unknown format %q (expected %s)\n", l.Format, strings.Join(listFormats, ", "))
+			return p, errUsage
+		}
+	}
+	if args.Query != nil {
+		if args.Query.match, err = enbypub.ParseMatch(args.Query.Match); err != nil {
+			p.WriteUsageForSubcommand(os.Stderr, p.SubcommandNames()...)
+			fmt.Fprintln(os.Stderr, "error: cannot parse match expression:", err)
+			return p, errUsage
+		}
+	}
+	if args.Verbose && args.Quiet {
+		p.WriteUsageForSubcommand(os.Stderr, p.SubcommandNames()...)
+		fmt.Fprintln(os.Stderr, "error: --verbose and --quiet cannot be used together")
+		return p, errUsage
+	}
+	return p, nil
+}
+
+// setting resolves a setting that can be given as a flag or in the site configuration: the flag
+// wins, then the configuration, then def. Both are set to the result, so templates see it.
+func setting(flag, config *string, def string) {
+	switch {
+	case *flag != "":
+	case *config != "":
+		*flag = *config
+	default:
+		*flag = def
+	}
+	*config = *flag
+}
+
+// queryList returns the list options of the query command, or nil if it isn't being run.
+func queryList() *ListCmd {
+	if args.Query == nil {
+		return nil
+	}
+	return &args.Query.ListCmd
+}
+
+// setup checks the root folder and fills in defaults that depend on other arguments.
+func setup() error {
 	if stat, err := os.Stat(args.Root); err != nil {
-		panic(fmt.Errorf("cannot use %q as a root: %w", args.Root, err))
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: args.Root, Err: fmt.Errorf("cannot use as a root: %w", err)}
 	} else if !stat.Mode().IsDir() {
-		panic(fmt.Errorf("cannot use %q as a root: not a directory", args.Root))
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: args.Root, Err: errors.New("cannot use as a root: not a directory")}
 	}
 	rootDir = os.DirFS(args.Root)
+
+	fn, missingOK := args.Config, args.Config == ""
+	if missingOK {
+		fn = enbypub.SiteConfigFile
+	}
+	var err error
+	if site, err = enbypub.LoadSiteConfig(filepath.Join(args.Root, fn), missingOK); err != nil {
+		return err
+	}
+	setting(&args.PublicDir, &site.Public, "public")
+	setting(&args.ContentDir, &site.Content, "content")
+	setting(&args.TemplatesDir, &site.Templates, "templates")
+	setting(&args.AssetsDir, &site.Assets, "assets")
+	setting(&args.FeedsYaml, &site.Feeds, "_feeds.yaml")
+	setting(&args.CacheDir, &site.Cache, ".enbypub-cache")
+	if args.New != nil {
+		setting(&args.New.Archetypes, &site.Archetypes, "archetypes")
+	}
+	if args.BaseURL != nil {
+		site.SetBaseURL(args.BaseURL)
+	} else {
+		args.BaseURL = site.URL()
+	}
+	if args.Collisions != "" {
+		site.Collisions = args.Collisions
+	}
+	site.Apply()
+	if args.TextFilePattern == nil {
+		// other formats are opt in, as a site may keep files in them that aren't Texts
+		args.TextFilePattern = regexp.MustCompile(`\.md$`)
+		if args.AllFormats {
+			args.TextFilePattern = enbypub.RendererPattern()
+		}
+	}
+	enbypub.ContentRoot, enbypub.TextFilePattern = args.ContentDir, args.TextFilePattern
+	for _, l := range []*ListCmd{args.List, queryList()} {
+		if l == nil {
+			continue
+		}
+		for _, d := range []*date{l.Since, l.Until} {
+			if d == nil {
+				continue
+			}
+			if err := d.parse(enbypub.Timezone); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
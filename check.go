@@ -0,0 +1,297 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	enbypub "github.com/ironiridis/enbypub/enbypublib"
+)
+
+// A problem is something check found wrong with the site.
+type problem struct {
+	// Check names the kind of problem, eg "duplicate-id"
+	Check string `json:"check"`
+
+	// Severity is "error" for problems that break the site, or "warning"
+	Severity string `json:"severity"`
+
+	// Kind is the enbypub.ErrorKind of the problem, eg "content"
+	Kind    string `json:"kind"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p problem) String() string {
+	loc := p.File
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	if loc != "" {
+		loc += ": "
+	}
+	return fmt.Sprintf("%s%s: %s [%s]", loc, p.Severity, p.Message, p.Check)
+}
+
+// checker collects problems.
+type checker struct {
+	problems []problem
+}
+
+func (c *checker) add(check, severity string, err error) {
+	p := problem{Check: check, Severity: severity, Kind: enbypub.Kind(err).String(), Message: err.Error()}
+	var se *enbypub.SourceError
+	if errors.As(err, &se) {
+		p.File, p.Line, p.Message = se.File, se.Line, se.Err.Error()
+	}
+	c.problems = append(c.problems, p)
+}
+
+func (c *checker) error(check string, err error) { c.add(check, "error", err) }
+
+// errors adds each of the SourceErrors joined in err as a problem of the check named joined, or
+// err as a problem of the check named single if it isn't joined.
+func (c *checker) errors(joined, single string, err error) {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		c.error(single, err)
+		return
+	}
+	for _, err := range j.Unwrap() {
+		c.error(joined, err)
+	}
+}
+func (c *checker) warning(check string, err error) { c.add(check, "warning", err) }
+
+// check loads the site and generates it into a discard sink, reporting every problem it finds
+// rather than stopping at the first. Nothing is written: not the public folder, and not the
+// metadata that a build would assign to texts and feeds.
+func check(cmd *CheckCmd) error {
+	enbypub.ReadOnly = true
+	c := &checker{}
+	c.run()
+
+	slices.SortFunc(c.problems, func(a, b problem) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Message, b.Message))
+	})
+	var errs, warnings int
+	for _, p := range c.problems {
+		if p.Severity == "error" {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	if cmd.JSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		err := e.Encode(struct {
+			Problems []problem `json:"problems"`
+			Errors   int       `json:"errors"`
+			Warnings int       `json:"warnings"`
+		}{append([]problem{}, c.problems...), errs, warnings})
+		if err != nil {
+			return fmt.Errorf("cannot write check results: %w", err)
+		}
+	} else {
+		for _, p := range c.problems {
+			fmt.Fprintln(os.Stdout, p)
+		}
+	}
+
+	if errs > 0 {
+		kind := enbypub.ErrorKindUnknown
+		for _, p := range c.problems {
+			if p.Severity == "error" {
+				kind = kindNamed(p.Kind)
+				break
+			}
+		}
+		return &enbypub.SourceError{Kind: kind, File: args.Root, Err: fmt.Errorf("found %d errors and %d warnings", errs, warnings)}
+	}
+	slog.Info(fmt.Sprintf("found no errors and %d warnings", warnings))
+	return nil
+}
+
+func kindNamed(name string) enbypub.ErrorKind {
+	for k := enbypub.ErrorKindUnknown; k <= enbypub.ErrorKindIO; k++ {
+		if k.String() == name {
+			return k
+		}
+	}
+	return enbypub.ErrorKindUnknown
+}
+
+// run performs every check. Problems that stop later checks (eg an unparseable feeds file) end it
+// early.
+func (c *checker) run() {
+	files, err := ContentFiles()
+	if err != nil {
+		c.error("content", err)
+		return
+	}
+	content := make(enbypub.Texts)
+	for _, fn := range files {
+		T, err := enbypub.LoadTextFromFile(fn)
+		if err != nil {
+			c.error("front-matter", err)
+			continue
+		}
+		if other := content[*T.Id]; other != nil {
+			c.error("duplicate-id", &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: fn,
+				Err: fmt.Errorf("id %v is also used by %q; was this file copied?", T.Id, other.SourceFile())})
+			continue
+		}
+		content[*T.Id] = T
+	}
+
+	g := enbypub.NewDryRunGenerator(args.PublicDir)
+	g.Assets = filepath.Join(args.Root, args.AssetsDir)
+	g.BaseURL = args.BaseURL
+	g.Config = site
+	enbypub.ImageOptions.CacheDir = args.CacheDir
+	if g.Templates, err = enbypub.LoadTemplates(rootDir, args.TemplatesDir, g.Funcs()); err != nil {
+		c.error("template", err)
+		return
+	}
+	feeds, err := enbypub.LoadFeedsFromFile(args.FeedsYaml, g)
+	if err != nil {
+		// invalid path components and unknown attributes are reported together
+		c.errors("path-component", "feeds", err)
+		return
+	}
+	if err := feeds.Scan(content); err != nil {
+		// collisions are reported together
+		c.errors("path-collision", "feeds", err)
+		return
+	}
+	g.Site = enbypub.NewSite(feeds, content)
+	g.Site.Config = site
+
+	for _, T := range content {
+		published := false
+		for _, F := range feeds {
+			if slices.Contains(F.Index, T) {
+				published = true
+				break
+			}
+		}
+		if !published {
+			c.warning("unpublished", &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: T.SourceFile(),
+				Err: errors.New("text is not included in any feed")})
+		}
+	}
+
+	for _, F := range feeds {
+		c.generate(g, F)
+	}
+	if err := g.RenderSitePages(); err != nil {
+		c.error("render", err)
+	}
+	if err := g.PublishImages(); err != nil {
+		c.error("resource", err)
+	}
+
+	for _, F := range feeds {
+		c.links(g, F)
+	}
+}
+
+// generate renders every Text in F and closes its aggregators, into the discard sink of g.
+func (c *checker) generate(g *enbypub.Generator, F *enbypub.Feed) {
+	if len(F.CanonicalPath) > 0 {
+		CS, err := F.CanonicalStructure()
+		if err != nil {
+			c.error("path", err)
+			return
+		}
+		for fn, T := range CS.Files {
+			tmpl, err := F.TemplateFor(T)
+			if err != nil {
+				c.error("missing-template", err)
+				continue
+			}
+			if err := g.Claim(T.SourceFile(), fn); err != nil {
+				c.error("path-collision", &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: T.SourceFile(), Err: err})
+				continue
+			}
+			err = g.Template(F, tmpl, publish(g, F, T), T.Modified, fn)
+			if err != nil {
+				c.error("render", &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: T.SourceFile(),
+					Err: fmt.Errorf("cannot generate %q with template %q: %w", fn, tmpl, err)})
+			}
+			if err := F.CopyResources(T); err != nil {
+				c.error("resource", err)
+			}
+		}
+	}
+	if err := F.Close(); err != nil {
+		c.error("aggregator", &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: args.FeedsYaml,
+			Err: fmt.Errorf("feed %q: %w", *F.Slug, err)})
+	}
+}
+
+// links reports every link in the Texts of F to a path on the site that wasn't generated.
+func (c *checker) links(g *enbypub.Generator, F *enbypub.Feed) {
+	if len(F.CanonicalPath) == 0 {
+		return
+	}
+	for _, T := range F.Index {
+		dir := path.Dir(F.GetPath(T.Id.String()))
+		links, err := T.LinksIn(F)
+		if err != nil {
+			// rendering the page reports a body that can't be rendered
+			continue
+		}
+		for _, link := range links {
+			target, ok := internalLink(dir, link)
+			if !ok || linkExists(g, target) {
+				continue
+			}
+			c.error("broken-link", &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: T.SourceFile(),
+				Err: fmt.Errorf("feed %q: link to %q: nothing is published at /%s", *F.Slug, link, target)})
+		}
+	}
+}
+
+// internalLink returns the path relative to the public root that link refers to from a page in dir,
+// or false if link is external (has a scheme or host) or only a fragment.
+func internalLink(dir, link string) (string, bool) {
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		link = link[:i]
+	}
+	if link == "" || strings.HasPrefix(link, "//") || strings.Contains(link, ":") {
+		return "", false
+	}
+	if strings.HasPrefix(link, "/") {
+		return strings.TrimPrefix(path.Clean(link), "/"), true
+	}
+	return strings.TrimPrefix(path.Join(dir, link), "/"), true
+}
+
+// linkExists returns true if target (relative to the public root) was generated by g, or is a
+// directory with a generated index.html, or is an asset.
+func linkExists(g *enbypub.Generator, target string) bool {
+	for _, t := range []string{target, path.Join(target, "index.html")} {
+		if t == "." {
+			t = "index.html"
+		}
+		if g.Files[filepath.FromSlash(t)] != nil {
+			return true
+		}
+	}
+	if rel, ok := strings.CutPrefix(target, "assets/"); ok && g.Assets != "" {
+		if _, err := os.Stat(filepath.Join(g.Assets, filepath.FromSlash(rel))); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	enbypub "github.com/ironiridis/enbypub/enbypublib"
+)
+
+// clean removes everything in the public folder, and the image cache if asked to. It refuses to
+// remove a folder that contains the root, content or templates folders, in case the public folder
+// has been pointed somewhere it shouldn't be.
+func clean(cmd *CleanCmd) error {
+	dirs := []string{args.PublicDir}
+	if cmd.All {
+		dirs = append(dirs, args.CacheDir)
+	}
+	for _, dir := range dirs {
+		if err := checkRemovable(dir); err != nil {
+			return err
+		}
+		ents, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: dir, Err: err}
+		}
+		for _, e := range ents {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: dir, Err: err}
+			}
+		}
+		slog.Info(fmt.Sprintf("removed %d entries from %s", len(ents), dir))
+	}
+	return nil
+}
+
+// checkRemovable returns an error if removing the contents of dir would remove the root, content,
+// templates or assets folders or the feeds file.
+func checkRemovable(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: dir, Err: err}
+	}
+	for _, keep := range []string{".", args.Root, args.ContentDir, args.TemplatesDir, args.AssetsDir, args.FeedsYaml} {
+		k, err := filepath.Abs(keep)
+		if err != nil {
+			continue
+		}
+		if k == abs || strings.HasPrefix(k, abs+string(filepath.Separator)) {
+			return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: dir,
+				Err: fmt.Errorf("refusing to clean a folder containing %q", keep)}
+		}
+	}
+	return nil
+}
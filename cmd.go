@@ -1,46 +1,221 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	html "html/template"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 
+	"github.com/alexflint/go-arg"
 	enbypub "github.com/ironiridis/enbypub/enbypublib"
 )
 
+// Exit codes, so scripts can tell what kind of problem stopped enbypub.
+const (
+	exitError   = 1 // an unclassified error
+	exitUsage   = 2 // invalid command line arguments
+	exitConfig  = 3 // a problem with the feeds file, templates or other configuration
+	exitContent = 4 // a problem with a Text
+	exitIO      = 5 // a failure reading or writing files
+)
+
+// Publish is the data a Text is rendered with.
 type Publish struct {
+	Site *enbypub.Site
 	Feed *enbypub.Feed
 	Text *enbypub.Text
 	Meta *enbypub.MetaT
+
+	// Prev and Next are the Texts published in Feed just before and after Text, or nil
+	Prev, Next *enbypub.Text
+
+	// Series is the place of Text in its series in Feed, or nil if it isn't part of one
+	Series *enbypub.SeriesPosition
 }
 
-type Index struct {
-	Meta          *enbypub.MetaT
-	Feed          *enbypub.Feed
-	FeedStructure *enbypub.FeedStructure
-	Index         []*enbypub.Text
-	Seg           string
+// publish returns the data T is rendered with in F.
+func publish(g *enbypub.Generator, F *enbypub.Feed, T *enbypub.Text) *Publish {
+	P := &Publish{Site: g.Site, Feed: F, Text: T, Meta: enbypub.Meta(), Series: F.SeriesPosition(T)}
+	P.Prev, P.Next = F.Adjacent(T)
+	return P
 }
 
 func main() {
-	Generator := must1(enbypub.NewGenerator(args.PublicDir))
-	Content := must1(WalkContent())
-	Generator.Templates = must1(html.ParseFS(rootDir, args.TemplatesDir+"/*.html"))
-	Feeds := must1(enbypub.LoadFeedsFromFile(args.FeedsYaml, Generator))
-	must("populate feeds", Feeds.Scan(Content))
-
-	for _, F := range Feeds {
-		F.SortByCreatedDescending()
-		CS := must1(F.CanonicalStructure())
-		must("build directory structure", EnsurePath(CS))
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command line argv and returns the exit code.
+func run(argv []string) int {
+	p, err := parseArgs(argv)
+	switch {
+	case errors.Is(err, arg.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return exitError
+	}
+
+	level := slog.LevelInfo
+	if args.Verbose {
+		level = slog.LevelDebug
+	} else if args.Quiet {
+		level = slog.LevelError
+	}
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, level)))
+
+	if err := setup(); err != nil {
+		return report(err)
+	}
+	switch cmd := p.Subcommand().(type) {
+	case *NewCmd:
+		err = newText(cmd)
+	case *CheckCmd:
+		err = check(cmd)
+	case *ServeCmd:
+		err = serve(cmd)
+	case *ListCmd:
+		err = list(cmd, nil)
+	case *QueryCmd:
+		err = list(&cmd.ListCmd, cmd.match)
+	case *CleanCmd:
+		err = clean(cmd)
+	case *EjectCmd:
+		err = eject(cmd)
+	default:
+		err = build()
+	}
+	if err != nil {
+		return report(err)
+	}
+	return 0
+}
+
+// report logs err and returns the exit code for its kind.
+func report(err error) int {
+	slog.Error(err.Error())
+	switch enbypub.Kind(err) {
+	case enbypub.ErrorKindConfig:
+		return exitConfig
+	case enbypub.ErrorKindContent:
+		return exitContent
+	case enbypub.ErrorKindIO:
+		return exitIO
+	}
+	return exitError
+}
+
+// project holds everything loaded from the root folder that a build needs.
+type project struct {
+	Generator *enbypub.Generator
+	Content   enbypub.Texts
+	Feeds     enbypub.Feeds
+}
+
+// load reads the content, templates and feeds and assigns Texts to Feeds.
+func load() (*project, error) {
+	if err := os.MkdirAll(args.PublicDir, 0777); err != nil {
+		return nil, &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: args.PublicDir, Err: fmt.Errorf("cannot create public folder: %w", err)}
+	}
+	g, err := enbypub.NewGenerator(args.PublicDir)
+	if err != nil {
+		return nil, err
+	}
+	return loadWith(g)
+}
+
+// loadReadOnly loads as load does, but without writing anything: not the public folder, and not
+// the metadata assigned to texts and feeds.
+func loadReadOnly() (*project, error) {
+	enbypub.ReadOnly = true
+	return loadWith(enbypub.NewDryRunGenerator(args.PublicDir))
+}
+
+func loadWith(g *enbypub.Generator) (*project, error) {
+	var err error
+	g.Assets = filepath.Join(args.Root, args.AssetsDir)
+	g.BaseURL = args.BaseURL
+	g.Config = site
+	enbypub.ImageOptions.CacheDir = args.CacheDir
+
+	P := &project{Generator: g}
+	if P.Content, err = WalkContent(); err != nil {
+		return nil, err
+	}
+	if g.Templates, err = enbypub.LoadTemplates(rootDir, args.TemplatesDir, g.Funcs()); err != nil {
+		return nil, err
+	}
+	if P.Feeds, err = enbypub.LoadFeedsFromFile(args.FeedsYaml, g); err != nil {
+		return nil, err
+	}
+	if err := P.Feeds.Scan(P.Content); err != nil {
+		return nil, fmt.Errorf("cannot populate feeds: %w", err)
+	}
+	g.Site = enbypub.NewSite(P.Feeds, P.Content)
+	g.Site.Config = site
+	return P, nil
+}
+
+func build() error {
+	P, err := load()
+	if err != nil {
+		return err
+	}
+	g := P.Generator
+	for _, F := range P.Feeds {
+		CS, err := F.CanonicalStructure()
+		if err != nil {
+			return err
+		}
+		if err := EnsurePath(CS); err != nil {
+			return err
+		}
 		for fn, T := range CS.Files {
-			must("generate output file", Generator.Template(
-				must1(F.Get(enbypub.TextAttributeTemplate, T)),
-				&Publish{Feed: F, Text: T, Meta: enbypub.Meta()},
-				T.Modified,
-				fn))
+			tmpl, err := F.TemplateFor(T)
+			if err != nil {
+				return err
+			}
+			if err := g.Claim(T.SourceFile(), fn); err != nil {
+				return &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: T.SourceFile(), Err: err}
+			}
+			err = g.Template(F, tmpl, publish(g, F, T), T.Modified, fn)
+			if err != nil {
+				return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: T.SourceFile(),
+					Err: fmt.Errorf("cannot generate %q with template %q: %w", fn, tmpl, err)}
+			}
+			if err := F.CopyResources(T); err != nil {
+				return err
+			}
 		}
-		F.Close()
+		if err := F.Close(); err != nil {
+			return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: args.FeedsYaml, Err: fmt.Errorf("feed %q: %w", *F.Slug, err)}
+		}
+	}
+	if err := g.RenderSitePages(); err != nil {
+		return err
+	}
+	if err := g.PublishImages(); err != nil {
+		return err
+	}
+	manifest := g.Manifest()
+	slices.Sort(manifest)
+	for _, fn := range manifest {
+		slog.Debug("generated " + fn)
+	}
+	slog.Info(fmt.Sprintf("generated %d files from %d texts", len(manifest), len(P.Content)))
+	return nil
+}
+
+func eject(cmd *EjectCmd) error {
+	written, err := enbypub.EjectTheme(filepath.Join(args.Root, args.TemplatesDir), cmd.Force)
+	if err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: args.TemplatesDir, Err: err}
+	}
+	for _, fn := range written {
+		slog.Info("wrote " + fn)
 	}
-	fmt.Fprintf(os.Stdout, "generated files:\n%+v\n", Generator.Manifest())
+	return nil
 }
@@ -44,6 +44,12 @@ func (ga *genericAggregator) specialize() (a Aggregator, err error) {
 		a = &RobotsExcludeAggregator{Kind: ga.Kind}
 	case "rss":
 		a = &RSSAggregator{Kind: ga.Kind}
+	case "series":
+		a = &SeriesAggregator{Kind: ga.Kind}
+	case "socialcard":
+		a = &SocialCardAggregator{Kind: ga.Kind}
+	case "template":
+		a = &TemplateAggregator{Kind: ga.Kind}
 	default:
 		err = fmt.Errorf("cannot specialize into an unknown aggregator kind %q", ga.Kind)
 		return
@@ -30,6 +30,7 @@ type IndexAggregator struct {
 
 type IndexAggregatorContent struct {
 	Meta  *MetaT
+	Site  *Site
 	Feed  *Feed
 	Index []*Text
 }
@@ -83,8 +84,12 @@ func (ia *IndexAggregator) Close() (err error) {
 		case "oldest-first":
 			slices.SortFunc(ts, func(a *Text, b *Text) int { return a.Created.Compare(*b.Created) })
 		}
-		err = ia.g.Template(*ia.Template, &IndexAggregatorContent{
+		if err = ia.g.Claim(fmt.Sprintf("the index aggregator of feed %q", *ia.f.Slug), p, *ia.Filename); err != nil {
+			break
+		}
+		err = ia.g.Template(ia.f, *ia.Template, &IndexAggregatorContent{
 			Meta:  Meta(),
+			Site:  ia.g.Site,
 			Feed:  ia.f,
 			Index: ts,
 		}, &ia.newest, p, *ia.Filename)
@@ -13,14 +13,15 @@ import (
 	"golang.org/x/text/language"
 )
 
-// RSSDate formats a time.Time as an RFC 1123 time.
+// RSSDate formats a time.Time as an RFC 1123 time in Timezone, with a numeric offset as RFC 822
+// requires of zones other than GMT and the US zones.
 type RSSDate time.Time
 
 func (d *RSSDate) MarshalText() ([]byte, error) {
 	if d == nil {
 		return nil, errors.New("nil")
 	}
-	buf := (*time.Time)(d).Format(time.RFC1123)
+	buf := (*time.Time)(d).In(Timezone).Format(time.RFC1123Z)
 	return []byte(buf), nil
 }
 
@@ -40,14 +41,15 @@ type RSSAggregator struct {
 	MaxPath  *int    `yaml:",omitempty"`
 	Filename *string `yaml:",omitempty"`
 
-	// Title, if provided, is used as the RSS feed title value. Otherwise a default is made from the Feed slug.
+	// Title, if provided, is used as the RSS feed title value. Otherwise a default is made from the site title
+	// and the Feed slug.
 	Title *string `yaml:",omitempty"`
 
 	// Description, if provided, is used as the RSS description. Otherwise a default is made from the Feed slug.
 	Description *string `yaml:",omitempty"`
 
-	// PublicBaseURL is used to calculate the public URLs in this feed.
-	PublicBaseURL string
+	// PublicBaseURL is used to calculate the public URLs in this feed. The site BaseURL is used if it's empty.
+	PublicBaseURL string `yaml:",omitempty"`
 
 	// TTL is the minimum recommended refresh speed for consumers.
 	TTL *time.Duration `yaml:",omitempty"`
@@ -68,7 +70,11 @@ func (a *RSSAggregator) document() (*RSSFeedDocument, error) {
 	if a.Title != nil {
 		fd.Title = *a.Title
 	} else {
-		fd.Title = fmt.Sprintf("Feed: %s", *a.f.Slug)
+		site := a.g.SiteConfigOrDefault().Title
+		if site == "" {
+			site = "Feed"
+		}
+		fd.Title = fmt.Sprintf("%s: %s", site, *a.f.Slug)
 	}
 	if a.Description != nil {
 		fd.Description = *a.Description
@@ -89,7 +95,11 @@ func (a *RSSAggregator) document() (*RSSFeedDocument, error) {
 	if a.TTL != nil {
 		fd.TTL = int(a.TTL.Minutes())
 	}
-	if u, err := url.Parse(a.PublicBaseURL); err != nil {
+	fd.Language = a.g.SiteConfigOrDefault().LanguageTag()
+	if a.PublicBaseURL == "" && a.g.BaseURL != nil {
+		fd.baseURL = a.g.BaseURL
+		fd.Link = a.g.BaseURL.String()
+	} else if u, err := url.Parse(a.PublicBaseURL); err != nil {
 		return nil, fmt.Errorf("cannot produce RSS document, failed to parse public base URL %q: %w", a.PublicBaseURL, err)
 	} else {
 		fd.baseURL = u
@@ -130,6 +140,10 @@ type RSSFeedDocument struct {
 	Items []*RSSFeedItem `xml:"channel>item,omitempty"`
 
 	baseURL *url.URL
+
+	// lang is the language of every item so far, unless mixedLang
+	lang      string
+	mixedLang bool
 }
 
 func NewRSSFeedDocument() *RSSFeedDocument {
@@ -187,10 +201,16 @@ func (a *RSSAggregator) AddText(t *Text) error {
 		}
 		doc.Items = append(doc.Items, &RSSFeedItem{
 			Title:   *t.Title,
-			Link:    doc.baseURL.JoinPath(a.f.GetPath(t.Id.String())).String(), // TODO - gross
+			Link:    doc.baseURL.JoinPath(a.f.GetURL(t.Id.String())).String(), // TODO - gross
 			PubDate: (*RSSDate)(t.Created),
 			Id:      t.Id,
 		})
+		switch l := t.Language(); {
+		case len(doc.Items) == 1:
+			doc.lang = l
+		case l != doc.lang:
+			doc.mixedLang = true
+		}
 	}
 	return nil
 }
@@ -198,7 +218,14 @@ func (a *RSSAggregator) AddText(t *Text) error {
 func (a *RSSAggregator) Close() error {
 	var err error
 	for p, doc := range a.indexes {
+		// a document of Texts all in one language is in that language, eg a per-language feed
+		if tag, err := language.Parse(doc.lang); err == nil && !doc.mixedLang {
+			doc.Language = &tag
+		}
 		//slices.SortFunc(ts, func(a *Text, b *Text) int { return b.Created.Compare(*a.Created) })
+		if err := a.g.Claim(fmt.Sprintf("the rss aggregator of feed %q", *a.f.Slug), p, *a.Filename); err != nil {
+			return err
+		}
 		fp := a.g.Create(p, *a.Filename).As(strptr("application/rss+xml")).At(&a.newest)
 		err = xml.NewEncoder(fp).Encode(doc)
 		if err != nil {
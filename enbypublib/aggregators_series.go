@@ -0,0 +1,110 @@
+package enbypub
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// SeriesAggregator renders a page for each series with parts in the Feed, listing the parts in
+// order. Each page is written to Directory/[series slug]/Filename. Feeds sharing a Directory
+// can't both have parts of a series with the same name, as they would write the same page.
+type SeriesAggregator struct {
+	f *Feed
+	g *Generator
+
+	// Kind is always "series"
+	Kind string
+
+	// Directory is where the series pages are written, relative to the public root; by default
+	// it's "series/[feed slug]", so each Feed lists its own parts of a series
+	Directory *string `yaml:",omitempty"`
+
+	// Filename is the name of each series page; by default it's "index.html"
+	Filename *string `yaml:",omitempty"`
+
+	// Template is the page template; by default it's "series.html"
+	Template *string `yaml:",omitempty"`
+
+	newest time.Time
+
+	// series is a map of series names to their parts
+	series map[string][]*Text
+}
+
+// SeriesAggregatorContent is the data the series template is executed with. Index lists the parts
+// of the series named Series, in order.
+type SeriesAggregatorContent struct {
+	Meta   *MetaT
+	Site   *Site
+	Feed   *Feed
+	Series string
+	Index  []*Text
+}
+
+func (a *SeriesAggregator) Init(f *Feed, g *Generator) error {
+	a.f = f
+	a.g = g
+	if a.Directory == nil {
+		a.Directory = strptr(path.Join("series", *f.Slug))
+	}
+	if a.Filename == nil {
+		a.Filename = strptr("index.html")
+	}
+	if a.Template == nil {
+		a.Template = strptr("series.html")
+	}
+	a.series = make(map[string][]*Text)
+	return nil
+}
+
+func (a *SeriesAggregator) AddText(t *Text) error {
+	if t.Series == nil {
+		return nil
+	}
+	if t.Created != nil && t.Created.After(a.newest) {
+		a.newest = *t.Created
+	}
+	if t.Modified != nil && t.Modified.After(a.newest) {
+		a.newest = *t.Modified
+	}
+	a.series[t.Series.Name] = append(a.series[t.Series.Name], t)
+	return nil
+}
+
+// location returns the path of the page for the series named name, relative to the public root.
+func (a *SeriesAggregator) location(name string) string {
+	return path.Join(*a.Directory, *Sluggify(&name), *a.Filename)
+}
+
+func (a *SeriesAggregator) Close() error {
+	names := make([]string, 0, len(a.series))
+	for name := range a.series {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		parts := a.series[name]
+		sortSeriesParts(parts)
+		dst := filepath.FromSlash(a.location(name))
+		if err := a.g.Claim(fmt.Sprintf("the series aggregator of feed %q", *a.f.Slug), dst); err != nil {
+			return err
+		}
+		if err := a.g.MkdirAll(filepath.Dir(dst)); err != nil {
+			return fmt.Errorf("cannot create directory for series %q: %w", name, err)
+		}
+		err := a.g.Template(a.f, *a.Template, &SeriesAggregatorContent{
+			Meta:   Meta(),
+			Site:   a.g.Site,
+			Feed:   a.f,
+			Series: name,
+			Index:  parts,
+		}, &a.newest, dst)
+		if err != nil {
+			return fmt.Errorf("cannot render series %q: %w", name, err)
+		}
+	}
+	return nil
+}
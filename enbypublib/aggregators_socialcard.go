@@ -0,0 +1,346 @@
+package enbypub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// SocialCardAggregator renders a PNG preview image (an Open Graph or Twitter card) for each Text
+// in the Feed, published next to the Text's output file (or its directory, with URLStyleDirectory).
+type SocialCardAggregator struct {
+	f *Feed
+	g *Generator
+
+	// Kind is always "socialcard"
+	Kind string
+
+	// Width and Height are the card dimensions in pixels; 1200x630 by default
+	Width  *int `yaml:",omitempty"`
+	Height *int `yaml:",omitempty"`
+
+	// Padding is the margin around the card contents in pixels
+	Padding *int `yaml:",omitempty"`
+
+	// TitleSize and CaptionSize are font sizes in pixels
+	TitleSize   *float64 `yaml:",omitempty"`
+	CaptionSize *float64 `yaml:",omitempty"`
+
+	// Background, Foreground and Accent are colors as #rgb or #rrggbb
+	Background *string `yaml:",omitempty"`
+	Foreground *string `yaml:",omitempty"`
+	Accent     *string `yaml:",omitempty"`
+
+	// Logo, if provided, is the path of a PNG or JPEG image in the assets folder, drawn in the
+	// bottom corner of the card
+	Logo *string `yaml:",omitempty"`
+
+	// Caption is a text/template rendered with the same data as the Text page (Feed, Text, Meta),
+	// with the template functions (eg date), and drawn under the title. By default it shows the
+	// Feed slug and the Created date.
+	Caption *string `yaml:",omitempty"`
+
+	caption *template.Template
+	logo    string
+	texts   []*Text
+}
+
+// SocialCardAggregatorContent is the data the Caption template is executed with.
+type SocialCardAggregatorContent struct {
+	Meta *MetaT
+	Site *Site
+	Feed *Feed
+	Text *Text
+}
+
+func (a *SocialCardAggregator) Init(f *Feed, g *Generator) (err error) {
+	a.f = f
+	a.g = g
+	if a.Width == nil {
+		a.Width = new(int)
+		*a.Width = 1200
+	}
+	if a.Height == nil {
+		a.Height = new(int)
+		*a.Height = 630
+	}
+	if a.Padding == nil {
+		a.Padding = new(int)
+		*a.Padding = 72
+	}
+	if a.TitleSize == nil {
+		a.TitleSize = new(float64)
+		*a.TitleSize = 72
+	}
+	if a.CaptionSize == nil {
+		a.CaptionSize = new(float64)
+		*a.CaptionSize = 32
+	}
+	if a.Background == nil {
+		a.Background = strptr("#1d1f21")
+	}
+	if a.Foreground == nil {
+		a.Foreground = strptr("#ffffff")
+	}
+	if a.Accent == nil {
+		a.Accent = strptr("#b294bb")
+	}
+	if a.Caption == nil {
+		a.Caption = strptr(`{{ .Feed.Slug }} · {{ date "2 January 2006" .Text.Created }}`)
+	}
+	for _, c := range []*string{a.Background, a.Foreground, a.Accent} {
+		if _, err := parseHexColor(*c); err != nil {
+			return fmt.Errorf("invalid social card color: %w", err)
+		}
+	}
+	if a.Logo != nil {
+		rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(*a.Logo), "/assets/"))
+		if g.Assets == "" || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("social card logo %q is not in the assets folder", *a.Logo)
+		}
+		a.logo = filepath.Join(g.Assets, filepath.FromSlash(rel))
+	}
+	if a.caption, err = template.New("caption").Funcs(template.FuncMap(TemplateFuncs)).Parse(*a.Caption); err != nil {
+		return fmt.Errorf("cannot parse social card caption template: %w", err)
+	}
+	return nil
+}
+
+func (a *SocialCardAggregator) AddText(t *Text) error {
+	a.texts = append(a.texts, t)
+	return nil
+}
+
+// location returns the path components of the card for t, with the filename last.
+func (a *SocialCardAggregator) location(t *Text) ([]string, error) {
+	p, err := a.f.Path(t)
+	if err != nil {
+		return nil, err
+	}
+	name, err := a.f.name(t)
+	if err != nil {
+		return nil, err
+	}
+	return append(p, name+".png"), nil
+}
+
+// URL returns the public path of the card for t.
+func (a *SocialCardAggregator) URL(t *Text) string {
+	p, err := a.location(t)
+	if err != nil {
+		return ""
+	}
+	return "/" + path.Join(p...)
+}
+
+func (a *SocialCardAggregator) Close() error {
+	for _, t := range a.texts {
+		loc, err := a.location(t)
+		if err != nil {
+			return fmt.Errorf("cannot place social card for %v: %w", t, err)
+		}
+		var caption bytes.Buffer
+		if err := a.caption.Execute(&caption, &SocialCardAggregatorContent{Meta: Meta(), Site: a.g.Site, Feed: a.f, Text: t}); err != nil {
+			return fmt.Errorf("cannot render social card caption for %v: %w", t, err)
+		}
+		card, err := a.card(t, caption.String())
+		if err != nil {
+			return fmt.Errorf("cannot render social card for %v: %w", t, err)
+		}
+		if err := a.g.MkdirAll(filepath.Join(loc[:len(loc)-1]...)); err != nil {
+			return fmt.Errorf("cannot create directory for social card: %w", err)
+		}
+		fp := a.g.Create(loc...).At(t.Modified)
+		fp.Write(card)
+		if err := fp.Close(); err != nil {
+			return fmt.Errorf("failed to write social card for %v: %w", t, err)
+		}
+	}
+	return nil
+}
+
+// card returns the encoded PNG card for t, from the cache if possible.
+func (a *SocialCardAggregator) card(t *Text, caption string) ([]byte, error) {
+	var title, checksum string
+	if t.Title != nil {
+		title = *t.Title
+	}
+	if t.Checksum != nil {
+		checksum = *t.Checksum
+	}
+	opts, _ := json.Marshal(a)
+	var logo string
+	if a.logo != "" {
+		if fi, err := os.Stat(a.logo); err == nil {
+			logo = fi.ModTime().String()
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{title, checksum, caption, string(opts), logo}, "\x00")))
+	var cached string
+	if ImageOptions != nil && ImageOptions.CacheDir != "" {
+		cached = filepath.Join(ImageOptions.CacheDir, "card-"+hex.EncodeToString(sum[:16])+".png")
+		if b, err := os.ReadFile(cached); err == nil {
+			return b, nil
+		}
+	}
+
+	img, err := a.render(title, caption)
+	if err != nil {
+		return nil, err
+	}
+	var B bytes.Buffer
+	if err := png.Encode(&B, img); err != nil {
+		return nil, err
+	}
+	if cached != "" && !a.g.DryRun {
+		if err := os.MkdirAll(ImageOptions.CacheDir, 0777); err == nil {
+			os.WriteFile(cached, B.Bytes(), 0666)
+		}
+	}
+	return B.Bytes(), nil
+}
+
+func (a *SocialCardAggregator) render(title, caption string) (image.Image, error) {
+	bg, _ := parseHexColor(*a.Background)
+	fg, _ := parseHexColor(*a.Foreground)
+	accent, _ := parseHexColor(*a.Accent)
+	w, h, pad := *a.Width, *a.Height, *a.Padding
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	// an accent bar along the left edge
+	draw.Draw(img, image.Rect(0, 0, pad/4, h), image.NewUniform(accent), image.Point{}, draw.Src)
+
+	titleFace, err := cardFace(gobold.TTF, *a.TitleSize)
+	if err != nil {
+		return nil, err
+	}
+	captionFace, err := cardFace(goregular.TTF, *a.CaptionSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(fg), Face: titleFace}
+	lineHeight := titleFace.Metrics().Height.Ceil()
+	y := pad + titleFace.Metrics().Ascent.Ceil()
+	maxLines := (h - 2*pad - 2*captionFace.Metrics().Height.Ceil()) / lineHeight
+	for _, line := range wrapText(d, title, w-2*pad, max(1, maxLines)) {
+		d.Dot = fixed.P(pad, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+
+	d.Face, d.Src = captionFace, image.NewUniform(accent)
+	d.Dot = fixed.P(pad, h-pad)
+	d.DrawString(caption)
+
+	if a.logo != "" {
+		if err := drawLogo(img, a.logo, pad); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// drawLogo scales the image at fn into the bottom right corner of img.
+func drawLogo(img *image.RGBA, fn string, pad int) error {
+	fp, err := os.Open(fn)
+	if err != nil {
+		return fmt.Errorf("cannot open logo: %w", err)
+	}
+	defer fp.Close()
+	logo, _, err := image.Decode(fp)
+	if err != nil {
+		return fmt.Errorf("cannot decode logo %q: %w", fn, err)
+	}
+	lb := logo.Bounds()
+	lh := pad * 3 / 2
+	lw := lb.Dx() * lh / max(1, lb.Dy())
+	b := img.Bounds()
+	dst := image.Rect(b.Dx()-pad-lw, b.Dy()-pad-lh+pad/4, b.Dx()-pad, b.Dy()-pad+pad/4)
+	draw.CatmullRom.Scale(img, dst, logo, lb, draw.Over, nil)
+	return nil
+}
+
+func cardFace(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse embedded font: %w", err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// wrapText breaks s into at most maxLines lines no wider than width, ending the last line with
+// an ellipsis if s doesn't fit.
+func wrapText(d *font.Drawer, s string, width, maxLines int) []string {
+	var lines []string
+	var cur string
+	words := strings.Fields(s)
+	for _, word := range words {
+		next := strings.TrimSpace(cur + " " + word)
+		if cur != "" && d.MeasureString(next).Ceil() > width {
+			lines = append(lines, cur)
+			cur = word
+			if len(lines) == maxLines {
+				last := []rune(lines[maxLines-1])
+				for len(last) > 0 && d.MeasureString(string(last)+"…").Ceil() > width {
+					last = last[:len(last)-1]
+				}
+				// cur and any words after it are left out
+				lines[maxLines-1] = strings.TrimSpace(string(last)) + "…"
+				return lines
+			}
+			continue
+		}
+		cur = next
+	}
+	if cur != "" {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// parseHexColor parses #rgb or #rrggbb into a color.
+func parseHexColor(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if len(h) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("%q is not a #rgb or #rrggbb color", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// SocialCardIn returns the public path of the social card image for T as published in F, or an
+// empty string if F doesn't produce social cards.
+func (T *Text) SocialCardIn(F *Feed) string {
+	if F == nil {
+		return ""
+	}
+	for _, a := range F.Aggregators {
+		if sc, ok := a.(*SocialCardAggregator); ok {
+			return sc.URL(T)
+		}
+	}
+	return ""
+}
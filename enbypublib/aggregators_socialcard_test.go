@@ -0,0 +1,79 @@
+package enbypub
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestWrapText(t *testing.T) {
+	face, err := cardFace(goregular.TTF, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &font.Drawer{Face: face}
+	width := d.MeasureString("aaaa bbbb").Ceil()
+	tests := []struct {
+		s        string
+		maxLines int
+		want     []string
+	}{
+		{"", 2, nil},
+		{"aaaa", 1, []string{"aaaa"}},
+		{"aaaa bbbb", 1, []string{"aaaa bbbb"}},
+		{"aaaa bbbb cccc", 2, []string{"aaaa bbbb", "cccc"}},
+		{"aaaa bbbb cccc dddd", 2, []string{"aaaa bbbb", "cccc dddd"}},
+		{"aaaa bbbb cccc", 1, []string{"aaaa bb…"}},
+		{"aaaa bbbb cccc dddd eeee", 2, []string{"aaaa bbbb", "cccc dd…"}},
+		{"  aaaa \n bbbb  ", 1, []string{"aaaa bbbb"}},
+	}
+	for _, tt := range tests {
+		got := wrapText(d, tt.s, width, tt.maxLines)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wrapText(%q, %d) = %q; want %q", tt.s, tt.maxLines, got, tt.want)
+		}
+		for _, line := range got {
+			if d.MeasureString(line).Ceil() > width {
+				t.Errorf("wrapText(%q, %d) gave %q, wider than %d", tt.s, tt.maxLines, line, width)
+			}
+		}
+	}
+}
+
+func TestSocialCardLogo(t *testing.T) {
+	assets := filepath.Join("site", "assets")
+	tests := []struct {
+		logo string
+		want string
+	}{
+		{"logo.png", filepath.Join(assets, "logo.png")},
+		{"img/logo.png", filepath.Join(assets, "img", "logo.png")},
+		{"/assets/img/logo.png", filepath.Join(assets, "img", "logo.png")},
+		{"img/../logo.png", filepath.Join(assets, "logo.png")},
+		{"../logo.png", ""},
+		{"/etc/logo.png", ""},
+	}
+	for _, tt := range tests {
+		g := NewDryRunGenerator("public")
+		g.Assets = assets
+		a := &SocialCardAggregator{Kind: "socialcard", Logo: strptr(tt.logo)}
+		err := a.Init(&Feed{}, g)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("logo %q resolved to %q; want an error", tt.logo, a.logo)
+		case tt.want != "" && err != nil:
+			t.Errorf("logo %q: %v", tt.logo, err)
+		case a.logo != tt.want:
+			t.Errorf("logo %q resolved to %q; want %q", tt.logo, a.logo, tt.want)
+		}
+	}
+
+	a := &SocialCardAggregator{Kind: "socialcard", Logo: strptr("logo.png")}
+	if err := a.Init(&Feed{}, NewDryRunGenerator("public")); err == nil || !strings.Contains(err.Error(), "assets") {
+		t.Errorf("logo without an assets folder gave %v; want an error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package enbypub
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TemplateAggregator renders an arbitrary template with every Text in the Feed, for outputs such
+// as humans.txt, .well-known files, CSV exports or custom XML. Text templates (see
+// TextTemplateSuffix) aren't HTML escaped. The template is rendered once for the Feed, or once per
+// canonical path directory if MinPath or MaxPath is set.
+type TemplateAggregator struct {
+	f *Feed
+	g *Generator
+
+	// Kind is always "template"
+	Kind string
+
+	// Template is the name of the template to render, eg "humans.txt.tmpl"
+	Template *string `yaml:",omitempty"`
+
+	// Filename is the output file name; by default it's the Template name without
+	// TextTemplateSuffix. When rendered once per Feed it's relative to the public root and may
+	// include directories (eg ".well-known/security.txt").
+	Filename *string `yaml:",omitempty"`
+
+	// ContentType is the content type of the output; by default it's guessed from Filename
+	ContentType *string `yaml:",omitempty"`
+
+	// MinPath and MaxPath, if either is set, render the template in each canonical path directory
+	// between these depths, as the index aggregator does
+	MinPath *int `yaml:",omitempty"`
+	MaxPath *int `yaml:",omitempty"`
+
+	// Sort is "newest-first" (the default) or "oldest-first"
+	Sort *string `yaml:",omitempty"`
+
+	newest  time.Time
+	indexes map[string][]*Text
+}
+
+// TemplateAggregatorContent is the data the template is executed with. Path is the directory the
+// output is written to, relative to the public root.
+type TemplateAggregatorContent struct {
+	Meta  *MetaT
+	Site  *Site
+	Feed  *Feed
+	Index []*Text
+	Path  string
+}
+
+func (a *TemplateAggregator) Init(f *Feed, g *Generator) error {
+	a.f = f
+	a.g = g
+	if a.Template == nil || *a.Template == "" {
+		return fmt.Errorf("template aggregator needs a template")
+	}
+	if a.Filename == nil {
+		a.Filename = strptr(strings.TrimSuffix(path.Base(*a.Template), TextTemplateSuffix))
+	}
+	if a.ContentType == nil {
+		if ct := ContentTypeFromExtension(path.Ext(*a.Filename)); ct != "" {
+			a.ContentType = &ct
+		}
+	}
+	if a.Sort == nil {
+		a.Sort = strptr("newest-first")
+	}
+	if *a.Sort != "newest-first" && *a.Sort != "oldest-first" {
+		return fmt.Errorf("unknown template aggregator sort %q", *a.Sort)
+	}
+	a.indexes = make(map[string][]*Text)
+	if !a.perPath() {
+		// rendered once, even if the Feed is empty
+		a.indexes[""] = nil
+	}
+	return nil
+}
+
+// perPath returns true if the template is rendered in each canonical path directory.
+func (a *TemplateAggregator) perPath() bool {
+	return a.MinPath != nil || a.MaxPath != nil
+}
+
+func (a *TemplateAggregator) AddText(t *Text) error {
+	if t.Created != nil && t.Created.After(a.newest) {
+		a.newest = *t.Created
+	}
+	if t.Modified != nil && t.Modified.After(a.newest) {
+		a.newest = *t.Modified
+	}
+	if !a.perPath() {
+		a.indexes[""] = append(a.indexes[""], t)
+		return nil
+	}
+	cpaths, err := a.f.Path(t)
+	if err != nil {
+		return fmt.Errorf("cannot get canonical path for template: %w", err)
+	}
+	for depth := range len(cpaths) {
+		if a.MinPath != nil && depth < *a.MinPath {
+			continue
+		}
+		if a.MaxPath != nil && depth > *a.MaxPath {
+			continue
+		}
+		p := path.Join(cpaths[:depth]...)
+		a.indexes[p] = append(a.indexes[p], t)
+	}
+	return nil
+}
+
+func (a *TemplateAggregator) Close() error {
+	if _, ok := a.g.Templates.Resolve(*a.f.Slug, *a.Template); !ok {
+		return fmt.Errorf("feed %q: template aggregator template %q does not exist", *a.f.Slug, *a.Template)
+	}
+	for p, ts := range a.indexes {
+		switch *a.Sort {
+		case "newest-first":
+			slices.SortFunc(ts, func(a *Text, b *Text) int { return b.Created.Compare(*a.Created) })
+		case "oldest-first":
+			slices.SortFunc(ts, func(a *Text, b *Text) int { return a.Created.Compare(*b.Created) })
+		}
+		dst := path.Join(p, *a.Filename)
+		if err := a.g.Claim(fmt.Sprintf("the template aggregator of feed %q", *a.f.Slug), filepath.FromSlash(dst)); err != nil {
+			return err
+		}
+		if err := a.g.MkdirAll(filepath.Dir(filepath.FromSlash(dst))); err != nil {
+			return fmt.Errorf("cannot create directory for %q: %w", dst, err)
+		}
+		fp := a.g.Create(filepath.FromSlash(dst)).At(&a.newest)
+		if a.ContentType != nil {
+			fp.As(a.ContentType)
+		}
+		err := a.g.Templates.Execute(fp, *a.f.Slug, *a.Template, &TemplateAggregatorContent{
+			Meta:  Meta(),
+			Site:  a.g.Site,
+			Feed:  a.f,
+			Index: ts,
+			Path:  p,
+		})
+		if cerr := fp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("cannot render template %q to %q: %w", *a.Template, dst, err)
+		}
+	}
+	return nil
+}
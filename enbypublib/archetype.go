@@ -0,0 +1,110 @@
+package enbypub
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	text "text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultArchetype is used to create a new Text when no archetype file applies.
+var DefaultArchetype = "---\n---\n\n"
+
+// ArchetypeData describes a new Text. It's the data an archetype is executed with, and its fields
+// are set in the front matter of the result.
+type ArchetypeData struct {
+	Title    string
+	Slug     string
+	Id       uuid.UUID
+	Created  time.Time
+	Tags     []string
+	Template string
+}
+
+// NewArchetypeData returns the ArchetypeData for a new Text titled title, with a new Id and the
+// current time.
+func NewArchetypeData(title string, tags []string) *ArchetypeData {
+	return &ArchetypeData{
+		Title:   title,
+		Slug:    *Sluggify(&title),
+		Id:      uuid.New(),
+		Created: time.Now().In(Timezone).Truncate(time.Second),
+		Tags:    tags,
+	}
+}
+
+// FindArchetype returns the name of the archetype file in fsys for a new Text with the given tags
+// that will be published in the Feeds with the given slugs. The first of `<tag>.*` for each tag,
+// `<feedslug>.*` for each Feed and `default.*` that exists is used, where the extension is any
+// with a Renderer. An empty string is returned if there is none.
+func FindArchetype(fsys fs.FS, tags []string, feeds []string) (string, error) {
+	names := append(append(slices.Clone(tags), feeds...), "default")
+	ents, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return "", fmt.Errorf("cannot read archetypes: %w", err)
+	}
+	for _, name := range names {
+		for _, e := range ents {
+			base := e.Name()
+			if e.Type().IsRegular() && strings.TrimSuffix(base, path.Ext(base)) == name && RendererFor(base) != nil {
+				return base, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// NewTextFromArchetype executes archetype (a text/template) with d and returns the contents of a
+// new Text: the output with the title, slug, id, created, tags and template of d set in its front
+// matter. Tags already in the archetype front matter are kept. YAML front matter is added if the
+// archetype has none.
+func NewTextFromArchetype(archetype string, d *ArchetypeData) ([]byte, error) {
+	t, err := text.New("archetype").Funcs(text.FuncMap(TemplateFuncs)).Parse(archetype)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse archetype: %w", err)
+	}
+	var B bytes.Buffer
+	if err := t.Execute(&B, d); err != nil {
+		return nil, fmt.Errorf("cannot execute archetype: %w", err)
+	}
+
+	fm, raw := splitFrontMatter(B.Bytes())
+	var existing Text
+	if err := fm.decode(&existing); err != nil {
+		return nil, fmt.Errorf("cannot read archetype front matter: %w", err)
+	}
+	tags := existing.Tags
+	for _, tag := range d.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	fields := []metadataField{
+		{"title", d.Title},
+		{"slug", d.Slug},
+		{"id", d.Id.String()},
+		{"created", d.Created},
+	}
+	if len(tags) > 0 {
+		fields = append(fields, metadataField{"tags", tags})
+	}
+	if d.Template != "" && existing.Template == nil {
+		fields = append(fields, metadataField{"template", d.Template})
+	}
+	if fm, err = fm.patch(fields); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(fm.open)
+	out.Write(fm.body)
+	out.Write(fm.close)
+	out.Write(raw)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,221 @@
+package enbypub
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BundleIndexName is the base name (without extension) of a Text that turns its directory into a
+// page bundle, eg `content/my-post/index.md`.
+var BundleIndexName = "index"
+
+// ContentRoot is the content folder. Only directories inside it can be page bundles: an index Text
+// in ContentRoot itself doesn't make the whole folder a bundle.
+var ContentRoot string
+
+// TextFilePattern matches the paths of Text files, which are never resources of a page bundle. If
+// it's nil, any file with a renderer (see RendererFor) is a Text file.
+var TextFilePattern *regexp.Regexp
+
+// A Resource is a file stored alongside a page bundle Text, such as an image or attachment. It is
+// published next to each output file of the Text.
+type Resource struct {
+	// Name is the slash separated path of the Resource relative to the bundle directory
+	Name string
+
+	// ContentType is the guessed content type of the Resource, or an empty string
+	ContentType string
+
+	// Size is the size of the Resource in bytes
+	Size int64
+
+	// source is the path the Resource is read from
+	source string
+
+	modtime time.Time
+	text    *Text
+}
+
+// URLIn returns the public path of the Resource as published in F, or just its Name (which is
+// valid relative to the Text) if F is nil.
+func (R *Resource) URLIn(F *Feed) string {
+	if R.text == nil || F == nil {
+		return R.Name
+	}
+	p, err := F.Path(R.text)
+	if err != nil {
+		return R.Name
+	}
+	return "/" + path.Join(append(p, R.Name)...)
+}
+
+// IsBundleIndex returns true if fn names a Text that makes its directory a page bundle. An index in
+// ContentRoot isn't one.
+func IsBundleIndex(fn string) bool {
+	if ContentRoot != "" && filepath.Clean(filepath.Dir(fn)) == filepath.Clean(ContentRoot) {
+		return false
+	}
+	base := filepath.Base(fn)
+	return strings.TrimSuffix(base, filepath.Ext(base)) == BundleIndexName && RendererFor(fn) != nil
+}
+
+// hasBundleIndex returns true if the directory dir contains a page bundle index Text.
+func hasBundleIndex(dir string) bool {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range ents {
+		if e.Type().IsRegular() && IsBundleIndex(filepath.Join(dir, e.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextFile returns true if fn is a Text file according to TextFilePattern.
+func isTextFile(fn string) bool {
+	if TextFilePattern != nil {
+		return TextFilePattern.MatchString(fn)
+	}
+	return RendererFor(fn) != nil
+}
+
+// loadResources finds every Resource in the bundle directory of T. Hidden files and directories
+// are skipped, as are nested directories which are bundles of their own, and Text files, which are
+// published as Texts rather than copied.
+func (T *Text) loadResources() error {
+	dir := filepath.Dir(T.originalFilename)
+	T.Resources = nil
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if hasBundleIndex(p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || p == T.originalFilename || isTextFile(p) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("cannot stat resource %q: %w", p, err)
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		T.Resources = append(T.Resources, &Resource{
+			Name:        filepath.ToSlash(rel),
+			ContentType: ContentTypeFromExtension(filepath.Ext(p)),
+			Size:        fi.Size(),
+			source:      p,
+			modtime:     fi.ModTime(),
+			text:        T,
+		})
+		return nil
+	})
+}
+
+// Resource returns the named Resource of T, or nil. name is interpreted relative to the bundle.
+func (T *Text) Resource(name string) *Resource {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	for _, R := range T.Resources {
+		if R.Name == name {
+			return R
+		}
+	}
+	return nil
+}
+
+// resourceReference matches URL attributes in rendered HTML.
+var resourceReference = regexp.MustCompile(`(\s(?:src|href|poster)=")([^"]*)(")`)
+
+// rewriteResources replaces relative references to Resources in a rendered HTML fragment with
+// their public URLs in F.
+func (T *Text) rewriteResources(F *Feed, frag string) string {
+	if len(T.Resources) == 0 {
+		return frag
+	}
+	return resourceReference.ReplaceAllStringFunc(frag, func(m string) string {
+		sm := resourceReference.FindStringSubmatch(m)
+		ref := sm[2]
+		if ref == "" || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+			return m
+		}
+		R := T.Resource(ref)
+		if R == nil {
+			return m
+		}
+		return sm[1] + R.URLIn(F) + sm[3]
+	})
+}
+
+// LinksIn returns the value of every src, href and poster attribute in the HTML of T, as rendered
+// for F.
+func (T *Text) LinksIn(F *Feed) ([]string, error) {
+	body, err := T.HTMLIn(F)
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	for _, sm := range resourceReference.FindAllStringSubmatch(string(body), -1) {
+		links = append(links, html.UnescapeString(sm[2]))
+	}
+	return links, nil
+}
+
+// CopyResources publishes each Resource of T next to its output file in this Feed.
+func (F *Feed) CopyResources(T *Text) error {
+	if len(T.Resources) == 0 {
+		return nil
+	}
+	p, err := F.Path(T)
+	if err != nil {
+		return fmt.Errorf("cannot copy resources of %v: %w", T, err)
+	}
+	for _, R := range T.Resources {
+		dst := append(append([]string{}, p...), strings.Split(R.Name, "/")...)
+		if isProcessableImage(R.source) {
+			pi, err := F.gen.ProcessImage(R.source)
+			if err != nil {
+				return fmt.Errorf("cannot process resource %q of %v: %w", R.Name, T, err)
+			}
+			if err := pi.publish(F.gen, dst[:len(dst)-1]); err != nil {
+				return fmt.Errorf("cannot publish resource %q of %v: %w", R.Name, T, err)
+			}
+			continue
+		}
+		if F.gen.Files[filepath.Join(dst...)] != nil {
+			slog.Warn("resource would overwrite an existing file", "resource", R.Name, "text", T)
+			continue
+		}
+		if err := F.gen.MkdirAll(filepath.Dir(filepath.Join(dst...))); err != nil {
+			return fmt.Errorf("cannot create directory for resource %q of %v: %w", R.Name, T, err)
+		}
+		if err := F.gen.Create(dst...).At(&R.modtime).From(R.source); err != nil {
+			return fmt.Errorf("cannot copy resource %q of %v: %w", R.Name, T, err)
+		}
+	}
+	return nil
+}
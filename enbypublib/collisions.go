@@ -0,0 +1,155 @@
+package enbypub
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A CollisionPolicy decides what happens when more than one Text (or one Text in more than one
+// Feed) would be published at the same output path.
+type CollisionPolicy string
+
+const (
+	// CollisionError fails the build, reporting every collision
+	CollisionError CollisionPolicy = "error"
+
+	// CollisionSuffix publishes the first Text at the path and the others with "-2", "-3" etc
+	// appended to their filenames. Texts in Feeds with a higher Priority come first, then older
+	// Texts, so an existing URL doesn't change when a new Text collides with it.
+	CollisionSuffix CollisionPolicy = "suffix"
+
+	// CollisionPriority publishes only the Text from the Feed with the highest Priority; it's
+	// removed from the other Feeds. Collisions between Feeds of the same Priority are errors.
+	CollisionPriority CollisionPolicy = "priority"
+)
+
+// PathCollisions is the policy for output path collisions applied by Feeds.Scan.
+var PathCollisions = CollisionError
+
+// UnmarshalText sets p from a policy name, so it can be used for flags and configuration.
+func (p *CollisionPolicy) UnmarshalText(b []byte) error {
+	switch v := CollisionPolicy(b); v {
+	case CollisionError, CollisionSuffix, CollisionPriority:
+		*p = v
+		return nil
+	}
+	return fmt.Errorf("unknown collision policy %q (expected %q, %q or %q)", b, CollisionError, CollisionSuffix, CollisionPriority)
+}
+
+// publication is a Text as published to a Feed at an output path.
+type publication struct {
+	F    *Feed
+	T    *Text
+	path string
+}
+
+func (p publication) String() string {
+	return fmt.Sprintf("%s (%v in feed %q)", p.T.SourceFile(), p.T, p.F.key)
+}
+
+// priority returns the Priority of the Feed, or 0 if it isn't set.
+func (F *Feed) priority() int {
+	if F.Priority != nil {
+		return *F.Priority
+	}
+	return 0
+}
+
+// comparePublications orders publications by which should keep a contested path: Feed Priority,
+// highest first, then the oldest Text, then by source file and Feed name so the order is stable.
+func comparePublications(a, b publication) int {
+	return cmp.Or(
+		cmp.Compare(b.F.priority(), a.F.priority()),
+		a.T.Created.Compare(*b.T.Created),
+		cmp.Compare(a.T.SourceFile(), b.T.SourceFile()),
+		cmp.Compare(a.F.key, b.F.key),
+	)
+}
+
+// publications returns every Text in every Feed with a CanonicalPath, grouped by output path.
+// Texts whose path can't be built are left for CanonicalStructure to report.
+func (f Feeds) publications() map[string][]publication {
+	paths := make(map[string][]publication)
+	for _, F := range f {
+		if len(F.CanonicalPath) == 0 {
+			continue
+		}
+		for _, T := range F.Index {
+			p, err := F.Path(T)
+			if err != nil {
+				continue
+			}
+			fn, err := F.Filename(T)
+			if err != nil {
+				continue
+			}
+			k := strings.Join(append(p, fn), "/")
+			paths[k] = append(paths[k], publication{F, T, k})
+		}
+	}
+	return paths
+}
+
+// resolveCollisions finds Texts published at the same output path, within a Feed or across Feeds,
+// and applies policy. It returns a SourceError for each collision it can't resolve, joined.
+func (f Feeds) resolveCollisions(policy CollisionPolicy) error {
+	paths := f.publications()
+	contested := make([]string, 0)
+	for k, ps := range paths {
+		if len(ps) > 1 {
+			slices.SortFunc(ps, comparePublications)
+			contested = append(contested, k)
+		}
+	}
+	slices.Sort(contested)
+
+	var errs []error
+	collision := func(a, b publication, reason string) {
+		errs = append(errs, &SourceError{Kind: ErrorKindContent, File: b.T.SourceFile(),
+			Err: fmt.Errorf("output path %q collides: %v and %v both publish there%s", a.path, a, b, reason)})
+	}
+	for _, k := range contested {
+		ps := paths[k]
+		switch policy {
+		case CollisionSuffix:
+			for _, p := range ps[1:] {
+				p.F.suffixFor(p.T, paths)
+			}
+		case CollisionPriority:
+			for _, p := range ps[1:] {
+				if p.F.priority() == ps[0].F.priority() {
+					collision(ps[0], p, fmt.Sprintf(" with feed priority %d", p.F.priority()))
+					continue
+				}
+				p.F.Index = slices.DeleteFunc(p.F.Index, func(T *Text) bool { return T == p.T })
+			}
+		default:
+			for _, p := range ps[1:] {
+				collision(ps[0], p, "")
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// suffixFor finds the first numbered suffix that gives T an output path in F that isn't in paths,
+// and assigns it. The new path is added to paths.
+func (F *Feed) suffixFor(T *Text, paths map[string][]publication) {
+	p, _ := F.Path(T)
+	name, _ := F.name(T)
+	for n := 2; ; n++ {
+		s := fmt.Sprintf("-%d", n)
+		k := strings.Join(append(p, F.urlStyle().filename(name+s)), "/")
+		if _, taken := paths[k]; !taken {
+			if F.suffixes == nil {
+				F.suffixes = make(map[*Text]string)
+			}
+			F.suffixes[T] = s
+			paths[k] = []publication{{F, T, k}}
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package enbypub
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v2"
+)
+
+// SiteConfigFile is the name of the site configuration file, relative to the site root.
+var SiteConfigFile = "enbypub.yaml"
+
+// SiteConfig holds the settings of a site, read from its configuration file. Every field is
+// optional. Command line flags override the directories, BaseURL and Collisions.
+type SiteConfig struct {
+	// Title, Description and Author describe the site for templates and aggregators
+	Title       string `yaml:",omitempty"`
+	Description string `yaml:",omitempty"`
+	Author      string `yaml:",omitempty"`
+
+	// Language is the BCP 47 tag of the language the site is written in, eg "en" or "de-CH", and
+	// of Texts that don't set their own; see DefaultLanguage
+	Language string `yaml:",omitempty"`
+
+	// BaseURL is the public URL of the published site, used for absolute links
+	BaseURL string `yaml:"baseurl,omitempty"`
+
+	// Timezone is the IANA name of the time zone the site is published in, eg "Europe/Berlin".
+	// The default is UTC.
+	Timezone string `yaml:",omitempty"`
+
+	// Public, Content, Templates, Assets, Cache and Archetypes are directories relative to the
+	// root, and Feeds is the feeds file
+	Public     string `yaml:",omitempty"`
+	Content    string `yaml:",omitempty"`
+	Templates  string `yaml:",omitempty"`
+	Assets     string `yaml:",omitempty"`
+	Cache      string `yaml:",omitempty"`
+	Archetypes string `yaml:",omitempty"`
+	Feeds      string `yaml:",omitempty"`
+
+	// Collisions is the CollisionPolicy for Texts published at the same path
+	Collisions CollisionPolicy `yaml:",omitempty"`
+
+	// ThemePages renders the SitePages of DefaultTheme (a search page and a 404 page) when the
+	// templates directory doesn't have its own
+	ThemePages bool `yaml:"themepages,omitempty"`
+
+	// Images overrides fields of ImageOptions
+	Images *ImageOptionsT `yaml:",omitempty"`
+
+	// Markdown sets MarkdownOptions
+	Markdown *MarkdownOptionsT `yaml:",omitempty"`
+
+	// ContentTypes maps file extensions (without a dot) to the content type served for them,
+	// overriding the built in guesses
+	ContentTypes map[string]string `yaml:"contenttypes,omitempty"`
+
+	// Params holds any other settings, for templates
+	Params map[string]any `yaml:",omitempty"`
+
+	url      *url.URL
+	location *time.Location
+	lang     *language.Tag
+}
+
+// LoadSiteConfig reads the SiteConfig in fn. If fn doesn't exist and missingOK is set, an empty
+// SiteConfig is returned.
+func LoadSiteConfig(fn string, missingOK bool) (*SiteConfig, error) {
+	C := &SiteConfig{}
+	src, err := os.ReadFile(fn)
+	if errors.Is(err, fs.ErrNotExist) && missingOK {
+		return C, nil
+	} else if err != nil {
+		return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("cannot read site configuration: %w", err)}
+	}
+	if ImageOptions != nil {
+		defaults := *ImageOptions
+		C.Images = &defaults
+	}
+	if err := yaml.UnmarshalStrict(src, C); err != nil {
+		return nil, sourceError(ErrorKindConfig, fn, src, 0, fmt.Errorf("cannot load site configuration: %w", err))
+	}
+	if err := C.validate(); err != nil {
+		return nil, &SourceError{Kind: ErrorKindConfig, File: fn, Err: err}
+	}
+	return C, nil
+}
+
+// validate checks and parses the fields of C that need it.
+func (C *SiteConfig) validate() error {
+	C.url, C.location, C.lang = nil, nil, nil
+	if C.BaseURL != "" {
+		u, err := url.Parse(C.BaseURL)
+		if err != nil {
+			return fmt.Errorf("cannot parse baseurl: %w", err)
+		}
+		if !u.IsAbs() {
+			return fmt.Errorf("baseurl %q is not an absolute URL", C.BaseURL)
+		}
+		C.url = u
+	}
+	if C.Timezone != "" {
+		loc, err := time.LoadLocation(C.Timezone)
+		if err != nil {
+			return fmt.Errorf("cannot use timezone %q: %w", C.Timezone, err)
+		}
+		C.location = loc
+	}
+	if C.Language != "" {
+		tag, err := language.Parse(C.Language)
+		if err != nil {
+			return fmt.Errorf("cannot parse language %q: %w", C.Language, err)
+		}
+		C.lang = &tag
+	}
+	if C.Collisions != "" {
+		if err := new(CollisionPolicy).UnmarshalText([]byte(C.Collisions)); err != nil {
+			return err
+		}
+	}
+	for ext := range C.ContentTypes {
+		if strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("contenttypes: extension %q should not start with a dot", ext)
+		}
+	}
+	return nil
+}
+
+// SetBaseURL replaces BaseURL, eg with one given on the command line.
+func (C *SiteConfig) SetBaseURL(u *url.URL) {
+	C.BaseURL, C.url = u.String(), u
+}
+
+// URL returns the parsed BaseURL, or nil if it isn't set.
+func (C *SiteConfig) URL() *url.URL {
+	return C.url
+}
+
+// Location returns the time zone of the site, or UTC if Timezone isn't set.
+func (C *SiteConfig) Location() *time.Location {
+	if C.location == nil {
+		return time.UTC
+	}
+	return C.location
+}
+
+// LanguageTag returns the parsed Language, or nil if it isn't set.
+func (C *SiteConfig) LanguageTag() *language.Tag {
+	return C.lang
+}
+
+// Apply sets the package options the site configures: ImageOptions, MarkdownOptions,
+// ContentTypesExtra, PathCollisions, Timezone and DefaultLanguage.
+func (C *SiteConfig) Apply() {
+	if C.Images != nil && ImageOptions != nil {
+		ImageOptions = C.Images
+	}
+	if C.Markdown != nil {
+		MarkdownOptions = *C.Markdown
+	}
+	if len(C.ContentTypes) > 0 {
+		ContentTypesExtra = &ContentTypesExtraT{FromExtension: make(map[string]string, len(C.ContentTypes))}
+		for ext, ct := range C.ContentTypes {
+			ContentTypesExtra.FromExtension[strings.ToLower(ext)] = ct
+		}
+	}
+	if C.Collisions != "" {
+		PathCollisions = C.Collisions
+	}
+	Timezone = C.Location()
+	DefaultLanguage = C.Language
+}
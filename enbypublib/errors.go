@@ -0,0 +1,119 @@
+package enbypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+)
+
+// An ErrorKind classifies an error by what the user has to fix.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is an error that isn't otherwise classified
+	ErrorKindUnknown ErrorKind = iota
+
+	// ErrorKindConfig is a problem with the feeds file, a template or other site configuration
+	ErrorKindConfig
+
+	// ErrorKindContent is a problem with a Text
+	ErrorKindContent
+
+	// ErrorKindIO is a failure reading or writing a file
+	ErrorKindIO
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindConfig:
+		return "config"
+	case ErrorKindContent:
+		return "content"
+	case ErrorKindIO:
+		return "io"
+	}
+	return "unknown"
+}
+
+// A SourceError is an error attributed to a file, and a line in it if known.
+type SourceError struct {
+	Kind ErrorKind
+
+	// File is the path of the offending file
+	File string
+
+	// Line is the 1-based line number in File, or 0 if unknown
+	Line int
+
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the ErrorKind of err: the Kind of the first SourceError it wraps, ErrorKindIO for
+// file system errors, or ErrorKindUnknown.
+func Kind(err error) ErrorKind {
+	var se *SourceError
+	if errors.As(err, &se) {
+		return se.Kind
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return ErrorKindIO
+	}
+	return ErrorKindUnknown
+}
+
+// sourceError wraps err in a SourceError for fn. The line is found from err where possible (YAML,
+// TOML, JSON and template errors carry one) and is offset by skip lines, for errors in a part of
+// a file such as front matter; src is the part of the file that was being parsed.
+func sourceError(kind ErrorKind, fn string, src []byte, skip int, err error) error {
+	se := &SourceError{Kind: kind, File: fn, Err: err}
+	if line := errorLine(err, src); line > 0 {
+		se.Line = line + skip
+	}
+	return se
+}
+
+var (
+	yamlErrorLine     = regexp.MustCompile(`\bline (\d+)`)
+	templateErrorLine = regexp.MustCompile(`template: [^:]*:(\d+):`)
+)
+
+// errorLine returns the line number (within src) that err refers to, or 0.
+func errorLine(err error, src []byte) int {
+	var tpe toml.ParseError
+	if errors.As(err, &tpe) {
+		return tpe.Position.Line
+	}
+	var jse *json.SyntaxError
+	if errors.As(err, &jse) && int(jse.Offset) <= len(src) {
+		return bytes.Count(src[:jse.Offset], []byte("\n")) + 1
+	}
+	var jte *json.UnmarshalTypeError
+	if errors.As(err, &jte) && int(jte.Offset) <= len(src) {
+		return bytes.Count(src[:jte.Offset], []byte("\n")) + 1
+	}
+	for _, re := range []*regexp.Regexp{templateErrorLine, yamlErrorLine} {
+		if m := re.FindStringSubmatch(err.Error()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
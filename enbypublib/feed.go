@@ -1,6 +1,8 @@
 package enbypub
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,12 +13,18 @@ import (
 
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
 )
 
 type Feed struct {
 	// Tags specifies the list of tags that will be scanned to add content to this Feed
 	Tags []string `yaml:",omitempty"`
 
+	// Match, if specified, is a boolean expression a Text must satisfy to be added to this Feed. If
+	// Tags is also specified, a Text must be tagged with one of Tags and also satisfy Match.
+	// eg `public AND NOT draft`, `engineering AND (go OR rust)`, `public AND lang == "de"`
+	Match *string `yaml:",omitempty"`
+
 	// CanonicalPath specifies the location where a Text will be publicly reachable relative to a public root
 	// If empty/nil, this feed does not produce output files
 	CanonicalPath []PathComponent `yaml:",omitempty"`
@@ -46,8 +54,25 @@ type Feed struct {
 	// DefaultTemplate set a default "Style" value for a Text if one is not set
 	DefaultTemplate *string `yaml:",omitempty"`
 
-	fs  *FeedStructure
-	gen *Generator
+	// Priority ranks this Feed against others when Texts collide on an output path; see
+	// CollisionPolicy. The default is 0, and higher wins.
+	Priority *int `yaml:",omitempty"`
+
+	// URLStyle decides the output file and link of each Text; see URLStyle. The default is
+	// "file", ie "slug.html".
+	URLStyle *URLStyle `yaml:",omitempty"`
+
+	fs    *FeedStructure
+	gen   *Generator
+	match matchNode
+
+	// suffixes holds the filename suffix assigned to each Text moved aside by CollisionSuffix
+	suffixes map[*Text]string
+
+	// key is the name of this Feed in the feeds file, and file is the feeds file
+	key  string
+	file string
+	line int
 }
 
 // Sorts the Feed Index by the Created date of each Text, with the oldest first.
@@ -87,6 +112,24 @@ func (f *Feed) GetPath(id string) string {
 	return ""
 }
 
+// GetURL gets the path a Text id is linked as, relative to the public root: the same as GetPath,
+// except that Texts published as "slug/index.html" are linked as "slug/".
+func (f *Feed) GetURL(id string) string {
+	p := f.GetPath(id)
+	if p == "" {
+		return ""
+	}
+	return f.urlStyle().url(filepath.ToSlash(p))
+}
+
+// urlStyle returns the URLStyle of the Feed, or URLStyleFile if it isn't set.
+func (F *Feed) urlStyle() URLStyle {
+	if F.URLStyle != nil {
+		return *F.URLStyle
+	}
+	return URLStyleFile
+}
+
 func (F *Feed) Path(T *Text) ([]string, error) {
 	var err error
 	if len(F.CanonicalPath) == 0 {
@@ -102,7 +145,19 @@ func (F *Feed) Path(T *Text) ([]string, error) {
 	return C, nil
 }
 
+// Filename returns the output file of T, relative to its Path, according to the URLStyle of F.
+// With URLStyleDirectory it includes the directory named for T, eg "slug/index.html".
 func (F *Feed) Filename(T *Text) (string, error) {
+	name, err := F.name(T)
+	if err != nil {
+		return "", err
+	}
+	return F.urlStyle().filename(name), nil
+}
+
+// name returns the last canonical path component of T, with any suffix assigned by
+// CollisionSuffix.
+func (F *Feed) name(T *Text) (string, error) {
 	if len(F.CanonicalPath) == 0 {
 		return "", fmt.Errorf("cannot get Filename for %v because CanonicalPath is empty", F)
 	}
@@ -110,14 +165,14 @@ func (F *Feed) Filename(T *Text) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to get Filename for %v in %v: %w", T, F, err)
 	}
-
-	return fn + ".html", nil
+	return fn + F.suffixes[T], nil
 }
 
 func (F Feed) CanonicalStructure() (*FeedStructure, error) {
 	fs := &FeedStructure{
 		Segments: make(map[string][]*Text),
 		Files:    make(map[string]*Text, len(F.Index)),
+		style:    F.urlStyle(),
 	}
 	var P strings.Builder
 	for _, T := range F.Index {
@@ -135,7 +190,15 @@ func (F Feed) CanonicalStructure() (*FeedStructure, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot build structure for feed %v (%v): %w", F.Slug, F.Id, err)
 		}
+		if dir, _, ok := strings.Cut(fn, "/"); ok {
+			// the directory named for T (URLStyleDirectory) is a segment holding only T
+			fs.Segments[P.String()+dir] = append(fs.Segments[P.String()+dir], T)
+		}
 		P.WriteString(fn)
+		if other := fs.Files[P.String()]; other != nil {
+			return nil, &SourceError{Kind: ErrorKindContent, File: T.originalFilename, Err: fmt.Errorf(
+				"feed %q: output path %q collides: %v and %v both publish there", F.key, P.String(), other, T)}
+		}
 		fs.Files[P.String()] = T
 	}
 	F.fs = fs
@@ -164,6 +227,64 @@ func (F Feed) Get(a Attribute, T *Text) (string, error) {
 	return T.Get(a)
 }
 
+// TemplateFor returns the name of the page template T is rendered with in this Feed, from its
+// template attribute, the Feed DefaultTemplate or DefaultTextTemplate, checking that the template
+// exists.
+func (F *Feed) TemplateFor(T *Text) (string, error) {
+	var slug string
+	if F.Slug != nil {
+		slug = *F.Slug
+	}
+	name, err := F.Get(TextAttributeTemplate, T)
+	if err != nil {
+		name = DefaultTextTemplate
+	}
+	if _, ok := F.gen.Templates.Resolve(slug, name); !ok {
+		return "", &SourceError{Kind: ErrorKindContent, File: T.originalFilename, Err: fmt.Errorf(
+			"feed %q: text %v uses template %q, which does not exist (looked for %s)",
+			slug, T, name, strings.Join(quoteAll(templateCandidates(slug, name)), ", "))}
+	}
+	return name, nil
+}
+
+// Validate returns a SourceError for each problem with the definition of F: an unknown URLStyle,
+// an invalid PathComponent (see PathComponent.Validate), or an Attribute that isn't known, which wraps
+// ErrUnknownAttribute.
+func (F *Feed) Validate() []error {
+	var errs []error
+	if F.URLStyle != nil {
+		if err := new(URLStyle).UnmarshalText([]byte(*F.URLStyle)); err != nil {
+			errs = append(errs, &SourceError{Kind: ErrorKindConfig, File: F.file, Line: F.line,
+				Err: fmt.Errorf("feed %q: %w", F.key, err)})
+		}
+	}
+	for i, pc := range F.CanonicalPath {
+		if err := pc.Validate(); err != nil {
+			errs = append(errs, &SourceError{Kind: ErrorKindConfig, File: F.file, Line: F.line,
+				Err: fmt.Errorf("feed %q: canonical path component %d: %w", F.key, i, err)})
+		} else if pc.Attr != nil && !pc.Attr.IsKnown() {
+			errs = append(errs, &SourceError{Kind: ErrorKindConfig, File: F.file, Line: F.line,
+				Err: fmt.Errorf("feed %q: canonical path component %d: %w %q (front matter fields are written %s%s)",
+					F.key, i, ErrUnknownAttribute, *pc.Attr, TextAttributeParamPrefix, *pc.Attr)})
+		}
+	}
+	return errs
+}
+
+// Includes reports whether T should be published to this Feed according to its Tags and
+// Match expression.
+func (F *Feed) Includes(T *Text) bool {
+	if len(F.Tags) > 0 && !T.IsTagged(F.Tags...) {
+		return false
+	}
+	if F.match != nil {
+		return F.match.eval(T)
+	}
+	return len(F.Tags) > 0
+}
+
+// Add appends T to the Feed and passes it to each of its Aggregators. It doesn't check T for
+// output path collisions; Scan adds Texts with Add once those are resolved.
 func (F *Feed) Add(T *Text) error {
 	F.Index = append(F.Index, T)
 	for a := range F.Aggregators {
@@ -185,13 +306,25 @@ func (F *Feed) Close() error {
 
 type Feeds map[uuid.UUID]*Feed
 
+// Scan adds each Text in t to the Feeds that include it, resolving any output path collisions
+// according to PathCollisions before the Feed Aggregators see the Texts.
 func (f Feeds) Scan(t Texts) error {
 	for _, F := range f {
 		for _, T := range t {
-			if T.IsTagged(F.Tags...) {
-				if err := F.Add(T); err != nil {
-					return fmt.Errorf("failed to scan texts for feed %v: %w", F, err)
-				}
+			if F.Includes(T) {
+				F.Index = append(F.Index, T)
+			}
+		}
+	}
+	if err := f.resolveCollisions(PathCollisions); err != nil {
+		return err
+	}
+	for _, F := range f {
+		included := F.Index
+		F.Index = nil
+		for _, T := range included {
+			if err := F.Add(T); err != nil {
+				return fmt.Errorf("failed to scan texts for feed %q: %w", F.key, err)
 			}
 		}
 	}
@@ -205,6 +338,13 @@ type FeedStructure struct {
 
 	// Files is the generated final content path for each Text
 	Files map[string]*Text
+
+	style URLStyle
+}
+
+// URL returns the path the Text published at p (a key of Files) is linked as; see Feed.GetURL.
+func (fs *FeedStructure) URL(p string) string {
+	return fs.style.url(p)
 }
 
 // GetPath scans the file map for the specified uuid and returns the published Feed
@@ -230,47 +370,98 @@ func loadRawFeeds(r io.Reader) (rawFeed, error) {
 	return rf, err
 }
 
+// feedLine returns the line number of the top level key of the feed named k in src, or 0.
+func feedLine(src []byte, k string) int {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(src, &doc); err != nil || len(doc.Content) == 0 {
+		return 0
+	}
+	m := doc.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == k {
+			return m.Content[i].Line
+		}
+	}
+	return 0
+}
+
+// LoadFeedsFromFile reads the Feeds defined in fn, as ReadFeedsFromFile, and initializes their
+// aggregators to publish with g.
 func LoadFeedsFromFile(fn string, g *Generator) (Feeds, error) {
-	var mustRewrite bool
-	fp, err := os.Open(fn)
+	F, err := ReadFeedsFromFile(fn)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open feeds file %q: %w", fn, err)
+		return nil, err
+	}
+	for _, f := range F {
+		f.gen = g
+		for a := range f.Aggregators {
+			if err := f.Aggregators[a].Init(f, g); err != nil {
+				return nil, &SourceError{Kind: ErrorKindConfig, File: fn, Line: f.line,
+					Err: fmt.Errorf("feed %q: failed to initialize aggregator %d: %w", f.key, a, err)}
+			}
+		}
 	}
-	feeds, err := loadRawFeeds(fp)
-	fp.Close()
+	return F, nil
+}
+
+// ReadFeedsFromFile reads the Feeds defined in fn without preparing them to publish anything. Any
+// Feed without an Id or Slug is assigned one, and fn is updated to record it. Every invalid
+// PathComponent is reported, as SourceErrors joined together.
+func ReadFeedsFromFile(fn string) (Feeds, error) {
+	src, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("unable to open feeds file: %w", err)}
+	}
+	feeds, err := loadRawFeeds(bytes.NewReader(src))
 	if err != nil {
-		return nil, fmt.Errorf("unable to load feeds from %q: %w", fn, err)
+		return nil, sourceError(ErrorKindConfig, fn, src, 0, fmt.Errorf("unable to load feeds: %w", err))
 	}
 
-	F := make(Feeds, len(feeds))
+	// visit feeds in a stable order so that any rewrite is deterministic
+	keys := make([]string, 0, len(feeds))
 	for k := range feeds {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	updated := src
+	F := make(Feeds, len(feeds))
+	var invalid []error
+	for _, k := range keys {
+		var missing []metadataField
 		if feeds[k].Id == nil {
 			id := uuid.New()
 			feeds[k].Id = &id
-			mustRewrite = true
+			missing = append(missing, metadataField{"id", feeds[k].Id})
 		}
 		if feeds[k].Slug == nil {
 			feeds[k].Slug = Sluggify(&k)
-			mustRewrite = true
+			missing = append(missing, metadataField{"slug", feeds[k].Slug})
+		}
+		if len(missing) > 0 {
+			if updated, err = patchYAML(updated, []string{k}, missing...); err != nil {
+				return nil, &SourceError{Kind: ErrorKindConfig, File: fn, Err: fmt.Errorf("unable to update feed %q: %w", k, err)}
+			}
 		}
-		feeds[k].gen = g
-		for a := range feeds[k].Aggregators {
-			if err := feeds[k].Aggregators[a].Init(feeds[k], g); err != nil {
-				return nil, fmt.Errorf("failed to initialize aggregator %d of feed %+v: %w", a, feeds[k], err)
+		if feeds[k].Match != nil {
+			m, err := parseMatch(*feeds[k].Match)
+			if err != nil {
+				return nil, &SourceError{Kind: ErrorKindConfig, File: fn, Line: feedLine(src, k),
+					Err: fmt.Errorf("feed %q: cannot parse match expression: %w", k, err)}
 			}
+			feeds[k].match = m
 		}
+		feeds[k].key, feeds[k].file, feeds[k].line = k, fn, feedLine(src, k)
+		invalid = append(invalid, feeds[k].Validate()...)
 		F[*feeds[k].Id] = feeds[k]
 	}
+	if len(invalid) > 0 {
+		return nil, errors.Join(invalid...)
+	}
 
-	if mustRewrite {
-		fp, err := os.Create(fn)
-		if err != nil {
-			return nil, fmt.Errorf("unable to open feeds file %q to update: %w", fn, err)
-		}
-		err = yaml.NewEncoder(fp).Encode(feeds)
-		fp.Close()
-		if err != nil {
-			return nil, fmt.Errorf("unable to update %q: %w", fn, err)
+	if !ReadOnly && !bytes.Equal(updated, src) {
+		if err := os.WriteFile(fn, updated, 0o644); err != nil {
+			return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("unable to update: %w", err)}
 		}
 	}
 
@@ -164,7 +164,7 @@ func (f *File) Close() error {
 		f.err = fmt.Errorf("failed to Close() %q: %w", f.path, f.err)
 		return f.err
 	}
-	if f.modtime != nil {
+	if f.modtime != nil && !f.g.DryRun {
 		if f.err = os.Chtimes(f.ospath, time.Time{}, *f.modtime); f.err != nil {
 			f.err = fmt.Errorf("failed to set modification time on %q to %v: %w", f.path, *f.modtime, f.err)
 			return f.err
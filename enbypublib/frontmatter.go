@@ -0,0 +1,128 @@
+package enbypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// TextTOMLMetadataDelimiter indicates the text boundary between TOML metadata and body in a Text,
+// as used by Hugo and other generators.
+var TextTOMLMetadataDelimiter = regexp.MustCompile(`(?m:^\+\+\++[\r\n]+)`)
+
+// TextJSONMetadataStart matches a Text that begins with a JSON object as its front matter.
+var TextJSONMetadataStart = regexp.MustCompile(`\A\s*\{`)
+
+// FrontMatterFlavor identifies the format of the metadata section of a Text.
+type FrontMatterFlavor string
+
+const (
+	FrontMatterYAML = FrontMatterFlavor("yaml")
+	FrontMatterTOML = FrontMatterFlavor("toml")
+	FrontMatterJSON = FrontMatterFlavor("json")
+)
+
+// frontMatter is the metadata section of a Text file, split into its delimiters and body.
+type frontMatter struct {
+	// flavor is the format of body
+	flavor FrontMatterFlavor
+
+	// open is the opening delimiter, including anything that preceded it in the file
+	open []byte
+
+	// body is the metadata itself
+	body []byte
+
+	// close is the closing delimiter
+	close []byte
+}
+
+// splitFrontMatter finds the front matter in the contents of a Text file and returns it along
+// with the remaining body. If no front matter is found, fm is empty and raw is all of fbuf.
+func splitFrontMatter(fbuf []byte) (fm frontMatter, raw []byte) {
+	// JSON front matter is an object at the very start of the file
+	if TextJSONMetadataStart.Match(fbuf) {
+		dec := json.NewDecoder(bytes.NewReader(fbuf))
+		var obj json.RawMessage
+		if err := dec.Decode(&obj); err == nil && bytes.HasPrefix(obj, []byte("{")) {
+			end := int(dec.InputOffset())
+			start := end - len(obj)
+			// the line ending after the closing brace belongs to the front matter
+			close := end
+			if close < len(fbuf) && fbuf[close] == '\r' {
+				close++
+			}
+			if close < len(fbuf) && fbuf[close] == '\n' {
+				close++
+			}
+			return frontMatter{flavor: FrontMatterJSON, open: fbuf[:start], body: fbuf[start:end], close: fbuf[end:close]}, fbuf[close:]
+		}
+	}
+
+	// otherwise, whichever of the YAML or TOML delimiters appears first wins
+	yd := TextMetadataDelimiter.FindAllIndex(fbuf, 2)
+	td := TextTOMLMetadataDelimiter.FindAllIndex(fbuf, 2)
+	flavor, delimpos := FrontMatterYAML, yd
+	if len(td) == 2 && (len(yd) < 2 || td[0][0] < yd[0][0]) {
+		flavor, delimpos = FrontMatterTOML, td
+	}
+	if len(delimpos) != 2 {
+		return frontMatter{}, fbuf
+	}
+	return frontMatter{
+		flavor: flavor,
+		open:   fbuf[:delimpos[0][1]],
+		body:   fbuf[delimpos[0][1]:delimpos[1][0]],
+		close:  fbuf[delimpos[1][0]:delimpos[1][1]],
+	}, fbuf[delimpos[1][1]:]
+}
+
+// decode parses the front matter into T. TOML and JSON metadata are mapped onto the same fields
+// as YAML metadata, so any key that isn't a Text field ends up in Params.
+func (fm frontMatter) decode(T *Text) error {
+	var m map[string]any
+	switch fm.flavor {
+	case FrontMatterYAML:
+		return yaml.Unmarshal(fm.body, T)
+	case FrontMatterTOML:
+		if err := toml.Unmarshal(fm.body, &m); err != nil {
+			return fmt.Errorf("cannot parse TOML front matter: %w", err)
+		}
+	case FrontMatterJSON:
+		if err := json.Unmarshal(fm.body, &m); err != nil {
+			return fmt.Errorf("cannot parse JSON front matter: %w", err)
+		}
+	default:
+		return nil
+	}
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("cannot convert %s front matter: %w", fm.flavor, err)
+	}
+	return yaml.Unmarshal(b, T)
+}
+
+// patch returns a copy of fm with fields set in the body, keeping its original flavor. A Text
+// read without any front matter gets a new YAML front matter section.
+func (fm frontMatter) patch(fields []metadataField) (frontMatter, error) {
+	var err error
+	if fm.flavor == "" {
+		fm.flavor, fm.open, fm.close = FrontMatterYAML, []byte("---\n"), []byte("---\n")
+	}
+	switch fm.flavor {
+	case FrontMatterYAML:
+		fm.body, err = patchYAML(fm.body, nil, fields...)
+	case FrontMatterTOML:
+		fm.body, err = patchTOML(fm.body, fields...)
+	case FrontMatterJSON:
+		fm.body, err = patchJSON(fm.body, fields...)
+	}
+	if err != nil {
+		return fm, fmt.Errorf("cannot update %s front matter: %w", fm.flavor, err)
+	}
+	return fm, nil
+}
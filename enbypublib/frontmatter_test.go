@@ -0,0 +1,95 @@
+package enbypub
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestFrontMatterRoundTrip reads each testdata/frontmatter/*.md, assigns it the same metadata
+// and writes it back with PutFile, which must give the matching .golden file. Reading the result
+// must give back the metadata, and writing it again must not change it.
+func TestFrontMatterRoundTrip(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "frontmatter", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test inputs")
+	}
+	created := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, time.March, 6, 8, 30, 0, 0, time.UTC)
+	id := uuid.MustParse("622fdd5a-3248-41ee-b2a3-cd24bbbfe3f0")
+	meta := &Text{
+		Title:    strptr("A Text"),
+		Slug:     strptr("a-text"),
+		Created:  &created,
+		Modified: &modified,
+		Id:       &id,
+		Checksum: strptr("sha256:0123abcd"),
+	}
+
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".md")
+		src, err := os.ReadFile(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(in, ".md") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := filepath.Join(t.TempDir(), filepath.Base(in))
+
+		T := &Text{originalFilename: fn}
+		T.frontMatter, T.raw = splitFrontMatter(src)
+		if err := T.frontMatter.decode(T); err != nil {
+			t.Errorf("%s: cannot read metadata: %v", name, err)
+			continue
+		}
+		params := T.Params
+		T.Title, T.Slug, T.Created, T.Modified, T.Id, T.Checksum = meta.Title, meta.Slug, meta.Created, meta.Modified, meta.Id, meta.Checksum
+		if err := T.PutFile(); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		got, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: wrote\n%s\nwant\n%s", name, got, want)
+			continue
+		}
+
+		R := &Text{originalFilename: fn}
+		R.frontMatter, R.raw = splitFrontMatter(got)
+		if err := R.frontMatter.decode(R); err != nil {
+			t.Errorf("%s: cannot read metadata written: %v", name, err)
+			continue
+		}
+		switch {
+		case *R.Title != *meta.Title, *R.Slug != *meta.Slug, !R.Created.Equal(created), !R.Modified.Equal(modified),
+			*R.Id != id, *R.Checksum != *meta.Checksum:
+			t.Errorf("%s: read back %v %v %v %v %v %v", name, *R.Title, *R.Slug, R.Created, R.Modified, R.Id, *R.Checksum)
+		}
+		if len(R.Params) != len(params) {
+			t.Errorf("%s: read back params %v; want %v", name, R.Params, params)
+		}
+		if string(R.raw) != string(T.raw) {
+			t.Errorf("%s: read back body %q; want %q", name, R.raw, T.raw)
+		}
+
+		if err := R.PutFile(); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if again, _ := os.ReadFile(fn); string(again) != string(got) {
+			t.Errorf("%s: writing again changed\n%s\nto\n%s", name, got, again)
+		}
+	}
+}
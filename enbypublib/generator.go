@@ -2,7 +2,7 @@ package enbypub
 
 import (
 	"fmt"
-	html "html/template"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,7 +12,30 @@ import (
 type Generator struct {
 	Root      string
 	Files     map[string]*File
-	Templates *html.Template
+	Templates *TemplateSet
+
+	// Assets, if set, is the directory that public paths starting with /assets/ are read from
+	Assets string
+
+	// BaseURL, if set, is the public URL of the root, used to build absolute URLs
+	BaseURL *url.URL
+
+	// Site describes everything being published, for templates
+	Site *Site
+
+	// Config holds the site configuration; see SiteConfigOrDefault
+	Config *SiteConfig
+
+	// DryRun discards everything written, so a site can be generated to validate it without
+	// touching the public folder. Files are still recorded.
+	DryRun bool
+
+	// claims records what each page was generated from; see Claim
+	claims map[string]string
+
+	// assetImages holds the processed images in the assets folder that rendered Texts refer to,
+	// by their path in the assets folder; see PublishImages
+	assetImages map[string]*ProcessedImage
 }
 
 func NewGenerator(root string) (*Generator, error) {
@@ -26,10 +49,32 @@ func NewGenerator(root string) (*Generator, error) {
 	return &Generator{Root: root, Files: make(map[string]*File)}, nil
 }
 
+// NewDryRunGenerator returns a DryRun Generator for root, which need not exist.
+func NewDryRunGenerator(root string) *Generator {
+	return &Generator{Root: root, Files: make(map[string]*File), DryRun: true}
+}
+
+// SiteConfigOrDefault returns the Config of g, or an empty SiteConfig if it isn't set.
+func (g *Generator) SiteConfigOrDefault() *SiteConfig {
+	if g == nil || g.Config == nil {
+		return &SiteConfig{}
+	}
+	return g.Config
+}
+
 func (g *Generator) OSPath(path string) string {
 	return filepath.Join(g.Root, path)
 }
 
+// MkdirAll creates the directory path (relative to the Generator root) and any parents it needs,
+// unless this is a DryRun.
+func (g *Generator) MkdirAll(path string) error {
+	if g.DryRun {
+		return nil
+	}
+	return os.MkdirAll(g.OSPath(path), 0777)
+}
+
 // Create returns a *File for writing that has many of the semantics of an os.*File.
 // The method is intended to be chained together with other File methods. path may be a
 // single single composed path (eg `Create("directory/file.txt")`) or a series of path
@@ -56,7 +101,11 @@ func (g *Generator) Create(path ...string) (f *File) {
 		}
 	}
 
-	if fp, err := os.Create(f.ospath); err != nil {
+	create := os.Create
+	if g.DryRun {
+		create = func(string) (*os.File, error) { return os.OpenFile(os.DevNull, os.O_WRONLY, 0) }
+	}
+	if fp, err := create(f.ospath); err != nil {
 		f.err = fmt.Errorf("cannot create %q: %w", f.ospath, err)
 	} else {
 		f.fp = fp
@@ -65,11 +114,40 @@ func (g *Generator) Create(path ...string) (f *File) {
 	return
 }
 
-// Template is complicated
-func (g *Generator) Template(template string, data any, mtime *time.Time, path ...string) error {
+// Claim records that the page at path is generated from owner (eg a Text source file), and returns
+// an error if something else has already claimed it. Files that are shared by design, like
+// resources and processed images, aren't claimed.
+func (g *Generator) Claim(owner string, path ...string) error {
+	p := filepath.Join(path...)
+	if prev, ok := g.claims[p]; ok && prev != owner {
+		return fmt.Errorf("cannot generate %q from %s: already generated from %s", p, owner, prev)
+	}
+	if g.claims == nil {
+		g.claims = make(map[string]string)
+	}
+	g.claims[p] = owner
+	return nil
+}
+
+// Template renders the page template named template, as found for F (which may be nil), with data
+// into a new file at path. The file isn't created if there's no such template. If path has no
+// extension with a known content type (eg with URLStyleExtensionless), it's guessed from template.
+func (g *Generator) Template(F *Feed, template string, data any, mtime *time.Time, path ...string) error {
+	var feed string
+	if F != nil && F.Slug != nil {
+		feed = *F.Slug
+	}
+	if _, ok := g.Templates.Resolve(feed, template); !ok {
+		return fmt.Errorf("feed %q: template %q does not exist", feed, template)
+	}
 	fp := g.Create(path...).At(mtime)
 	defer fp.Close()
-	return g.Templates.ExecuteTemplate(fp, template, data)
+	if fp.contentType == nil {
+		if ct := ContentTypeFromExtension(filepath.Ext(template)); ct != "" {
+			fp.As(&ct)
+		}
+	}
+	return g.Templates.Execute(fp, feed, template, data)
 }
 
 // Manifest returns a list of each created file.
@@ -0,0 +1,439 @@
+package enbypub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// ImageOptionsT controls how JPEG and PNG images referenced by Texts are processed.
+type ImageOptionsT struct {
+	// Widths lists the widths in pixels of the resized variants generated for each image. Variants
+	// are only generated for widths smaller than the original image.
+	Widths []int
+
+	// Sizes is used as the sizes attribute of rewritten <img> elements.
+	Sizes string
+
+	// JPEGQuality is the quality (1-100) JPEG images are encoded with.
+	JPEGQuality int
+
+	// Format, if set to "jpeg" or "png", converts every processed image to that format. Otherwise
+	// images keep their original format.
+	Format string
+
+	// CacheDir, if set, is where processed images are kept between builds, keyed by a hash of
+	// the source image and these options. Otherwise images are processed on every build.
+	CacheDir string
+}
+
+// ImageOptions is used for every processed image. Setting it to nil disables image processing;
+// images are then published unchanged.
+var ImageOptions = &ImageOptionsT{
+	Widths:      []int{480, 960, 1600},
+	Sizes:       "(max-width: 960px) 100vw, 960px",
+	JPEGQuality: 85,
+}
+
+// An ImageVariant is one encoded size of a processed image.
+type ImageVariant struct {
+	// Name is the file name of the variant
+	Name   string
+	Width  int
+	Height int
+
+	// cached is the path of the encoded variant in the cache, or empty if data holds it
+	cached string
+	data   []byte
+}
+
+// ProcessedImage is a JPEG or PNG image that has been re-encoded without its metadata (including
+// any EXIF location data) and resized into variants.
+type ProcessedImage struct {
+	// Variants lists every variant by ascending width. The last variant is the full size image.
+	Variants []*ImageVariant
+
+	modtime time.Time
+}
+
+// Full returns the full size variant of the image.
+func (pi *ProcessedImage) Full() *ImageVariant {
+	return pi.Variants[len(pi.Variants)-1]
+}
+
+// processedImages holds every image processed during this run, by source path.
+var processedImages = map[string]*ProcessedImage{}
+
+// isProcessableImage returns true if fn looks like an image ProcessImage can handle.
+func isProcessableImage(fn string) bool {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".jpg", ".jpeg", ".png":
+		return ImageOptions != nil
+	}
+	return false
+}
+
+// ProcessImage re-encodes and resizes the JPEG or PNG image at src according to ImageOptions.
+// Results are reused for the rest of the run, and across runs if ImageOptions.CacheDir is set;
+// the cache is read but not written if g is a dry run. g may be nil.
+func (g *Generator) ProcessImage(src string) (*ProcessedImage, error) {
+	if pi := processedImages[src]; pi != nil {
+		return pi, nil
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat image %q: %w", src, err)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image %q: %w", src, err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(src))
+	switch ImageOptions.Format {
+	case "jpeg":
+		ext = ".jpg"
+	case "png":
+		ext = ".png"
+	}
+	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+
+	opts, _ := json.Marshal(ImageOptions)
+	sum := sha256.Sum256(append(data, opts...))
+	key := hex.EncodeToString(sum[:16])
+
+	pi := &ProcessedImage{modtime: fi.ModTime()}
+	if ImageOptions.CacheDir != "" {
+		if b, err := os.ReadFile(filepath.Join(ImageOptions.CacheDir, key+".json")); err == nil {
+			if err := json.Unmarshal(b, &pi.Variants); err == nil && len(pi.Variants) > 0 {
+				for _, v := range pi.Variants {
+					v.cached = filepath.Join(ImageOptions.CacheDir, key+"-"+v.Name)
+					v.Name = base + v.Name
+				}
+				processedImages[src] = pi
+				return pi, nil
+			}
+		}
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image %q: %w", src, err)
+	}
+	if format == "jpeg" {
+		img = orientImage(img, jpegOrientation(data))
+	}
+
+	b := img.Bounds()
+	// each width once, ending with the full size
+	widths := append(slices.Clone(ImageOptions.Widths), b.Dx())
+	slices.Sort(widths)
+	for _, w := range slices.Compact(widths) {
+		if w <= 0 || w > b.Dx() {
+			continue
+		}
+		v := &ImageVariant{Name: fmt.Sprintf("-%dw%s", w, ext), Width: w, Height: max(1, b.Dy()*w/b.Dx())}
+		var out image.Image = img
+		if w != b.Dx() {
+			dst := image.NewRGBA(image.Rect(0, 0, v.Width, v.Height))
+			draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+			out = dst
+		} else {
+			v.Name = ext
+		}
+		var B bytes.Buffer
+		if ext == ".png" {
+			err = png.Encode(&B, out)
+		} else {
+			err = jpeg.Encode(&B, out, &jpeg.Options{Quality: ImageOptions.JPEGQuality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %dpx wide variant of %q: %w", w, src, err)
+		}
+		v.data = B.Bytes()
+		pi.Variants = append(pi.Variants, v)
+	}
+
+	if ImageOptions.CacheDir != "" && (g == nil || !g.DryRun) {
+		if err := pi.store(key); err != nil {
+			slog.Warn("cannot cache processed image", "file", src, "err", err)
+		}
+	}
+	for _, v := range pi.Variants {
+		v.Name = base + v.Name
+	}
+	processedImages[src] = pi
+	return pi, nil
+}
+
+// store writes the variants of pi into the cache under key, along with a manifest describing
+// them. The variant names must not yet have had the image base name prepended.
+func (pi *ProcessedImage) store(key string) error {
+	if err := os.MkdirAll(ImageOptions.CacheDir, 0777); err != nil {
+		return err
+	}
+	for _, v := range pi.Variants {
+		if err := os.WriteFile(filepath.Join(ImageOptions.CacheDir, key+"-"+v.Name), v.data, 0666); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(pi.Variants)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ImageOptions.CacheDir, key+".json"), b, 0666)
+}
+
+// publish writes every variant of pi into the directory dir of g, skipping any already written.
+func (pi *ProcessedImage) publish(g *Generator, dir []string) error {
+	if err := g.MkdirAll(filepath.Join(dir...)); err != nil {
+		return fmt.Errorf("cannot create directory for image: %w", err)
+	}
+	for _, v := range pi.Variants {
+		p := filepath.Join(append(slices.Clone(dir), v.Name)...)
+		if g.Files[p] != nil {
+			continue
+		}
+		f := g.Create(p).At(&pi.modtime)
+		if v.cached != "" {
+			if err := f.From(v.cached); err != nil {
+				return err
+			}
+			continue
+		}
+		f.Write(v.data)
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// srcset returns the srcset attribute value for pi, given the URL of the directory it is
+// published in.
+func (pi *ProcessedImage) srcset(dir string) string {
+	s := make([]string, len(pi.Variants))
+	for i, v := range pi.Variants {
+		s[i] = fmt.Sprintf("%s %dw", path.Join(dir, v.Name), v.Width)
+	}
+	return strings.Join(s, ", ")
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of the JPEG data, or 1 if it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || i+2+size > len(data) {
+			// start of scan; no more metadata
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation finds the orientation tag in the first IFD of a TIFF structure.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder = binary.BigEndian
+	if string(t[:2]) == "II" {
+		bo = binary.LittleEndian
+	}
+	ifd := int(bo.Uint32(t[4:]))
+	if ifd+2 > len(t) {
+		return 1
+	}
+	n := int(bo.Uint16(t[ifd:]))
+	for e := 0; e < n; e++ {
+		o := ifd + 2 + e*12
+		if o+12 > len(t) {
+			return 1
+		}
+		if bo.Uint16(t[o:]) == 0x0112 {
+			if v := int(bo.Uint16(t[o+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orientImage rotates and flips img so that it displays upright given its EXIF orientation.
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = b.Dx()-1-x, y
+			case 3:
+				dx, dy = b.Dx()-1-x, b.Dy()-1-y
+			case 4:
+				dx, dy = x, b.Dy()-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = b.Dy()-1-y, x
+			case 7:
+				dx, dy = b.Dy()-1-y, b.Dx()-1-x
+			case 8:
+				dx, dy = y, b.Dx()-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// imageElement matches an <img> element in rendered HTML, and imageAttribute each of its
+// attributes.
+var imageElement = regexp.MustCompile(`<img\s[^>]*>`)
+var imageAttribute = regexp.MustCompile(`([a-zA-Z-]+)="([^"]*)"`)
+
+// image returns the processed image and public directory URL for an <img> src reference in the
+// body of T as published in F, or nil if it doesn't refer to a processable image. Nothing is
+// published: images in the assets folder are recorded for PublishImages, and Resources are
+// published by CopyResources.
+func (T *Text) image(F *Feed, src string) (*ProcessedImage, string) {
+	var g *Generator
+	if F != nil {
+		g = F.gen
+	}
+	if R := T.Resource(src); R != nil && !strings.HasPrefix(src, "/") && isProcessableImage(R.source) {
+		pi, err := g.ProcessImage(R.source)
+		if err != nil {
+			slog.Warn(err.Error(), "text", T)
+			return nil, ""
+		}
+		return pi, path.Dir(R.URLIn(F))
+	}
+	if g == nil || g.Assets == "" || !strings.HasPrefix(src, "/assets/") || !isProcessableImage(src) {
+		return nil, ""
+	}
+	rel := path.Clean(strings.TrimPrefix(src, "/assets/"))
+	if strings.HasPrefix(rel, "..") {
+		return nil, ""
+	}
+	pi, err := g.ProcessImage(filepath.Join(g.Assets, filepath.FromSlash(rel)))
+	if err != nil {
+		slog.Warn(err.Error(), "text", T)
+		return nil, ""
+	}
+	g.useAssetImage(rel, pi)
+	return pi, path.Dir("/assets/" + rel)
+}
+
+// useAssetImage records that a rendered Text refers to the processed image at rel in the assets
+// folder, so that PublishImages publishes its variants.
+func (g *Generator) useAssetImage(rel string, pi *ProcessedImage) {
+	if g.assetImages == nil {
+		g.assetImages = make(map[string]*ProcessedImage)
+	}
+	g.assetImages[rel] = pi
+}
+
+// PublishImages publishes the variants of every image in the assets folder that the Texts rendered
+// so far refer to, in the directory the image has under /assets/. Images that are Resources of a
+// page bundle are published by CopyResources instead.
+func (g *Generator) PublishImages() error {
+	rels := make([]string, 0, len(g.assetImages))
+	for rel := range g.assetImages {
+		rels = append(rels, rel)
+	}
+	slices.Sort(rels)
+	for _, rel := range rels {
+		dir := strings.Split(path.Dir(path.Join("assets", rel)), "/")
+		if err := g.assetImages[rel].publish(g, dir); err != nil {
+			return fmt.Errorf("cannot publish image %q: %w", "/assets/"+rel, err)
+		}
+	}
+	return nil
+}
+
+// rewriteImages turns each <img> element referring to a processable image into a responsive
+// image with srcset, sizes, width and height attributes, as published in F.
+func (T *Text) rewriteImages(F *Feed, frag string) string {
+	if ImageOptions == nil {
+		return frag
+	}
+	return imageElement.ReplaceAllStringFunc(frag, func(tag string) string {
+		attrs := imageAttribute.FindAllStringSubmatch(tag, -1)
+		var src string
+		for _, a := range attrs {
+			if a[1] == "src" {
+				src = a[2]
+			}
+		}
+		pi, dir := T.image(F, src)
+		if pi == nil {
+			return tag
+		}
+		full := pi.Full()
+		set := map[string]string{
+			"src":    path.Join(dir, full.Name),
+			"srcset": pi.srcset(dir),
+			"sizes":  ImageOptions.Sizes,
+			"width":  fmt.Sprint(full.Width),
+			"height": fmt.Sprint(full.Height),
+		}
+		var B strings.Builder
+		B.WriteString("<img")
+		for _, a := range attrs {
+			if v, ok := set[a[1]]; ok {
+				a[2] = v
+				delete(set, a[1])
+			}
+			fmt.Fprintf(&B, " %s=\"%s\"", a[1], a[2])
+		}
+		for _, k := range []string{"srcset", "sizes", "width", "height"} {
+			if v, ok := set[k]; ok && v != "" {
+				fmt.Fprintf(&B, " %s=\"%s\"", k, v)
+			}
+		}
+		if strings.HasSuffix(tag, "/>") {
+			B.WriteString(" />")
+		} else {
+			B.WriteString(">")
+		}
+		return B.String()
+	})
+}
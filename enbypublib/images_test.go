@@ -0,0 +1,102 @@
+package enbypub
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestPNG writes a w by h PNG image to fn.
+func writeTestPNG(t *testing.T, fn string, w, h int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fn), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useImageOptions sets ImageOptions for the rest of the test, with a fresh set of processed images.
+func useImageOptions(t *testing.T, opts *ImageOptionsT) {
+	saved, savedImages := ImageOptions, processedImages
+	t.Cleanup(func() { ImageOptions, processedImages = saved, savedImages })
+	ImageOptions, processedImages = opts, map[string]*ProcessedImage{}
+}
+
+func TestProcessImageWidths(t *testing.T) {
+	tests := []struct {
+		widths []int
+		want   []int
+	}{
+		{[]int{40, 80}, []int{40, 80, 100}},
+		{[]int{80, 40, 80, 40}, []int{40, 80, 100}},
+		{[]int{40, 100, 200}, []int{40, 100}},
+		{[]int{200, 100, 40, 100}, []int{40, 100}},
+		{[]int{0, -10, 40}, []int{40, 100}},
+		{nil, []int{100}},
+	}
+	src := filepath.Join(t.TempDir(), "photo.png")
+	writeTestPNG(t, src, 100, 50)
+	for _, tt := range tests {
+		useImageOptions(t, &ImageOptionsT{Widths: tt.widths})
+		pi, err := (*Generator)(nil).ProcessImage(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		names := map[string]bool{}
+		for _, v := range pi.Variants {
+			got = append(got, v.Width)
+			names[v.Name] = true
+		}
+		if !reflect.DeepEqual(got, tt.want) || len(names) != len(got) {
+			t.Errorf("widths %v gave variants %v (%d names); want %v", tt.widths, got, len(names), tt.want)
+		}
+		if full := pi.Full(); full.Name != "photo.png" || full.Width != 100 || full.Height != 50 {
+			t.Errorf("widths %v gave full size %+v", tt.widths, full)
+		}
+	}
+}
+
+func TestRenderDoesNotPublishImages(t *testing.T) {
+	useImageOptions(t, &ImageOptionsT{Widths: []int{40}, Sizes: "100vw"})
+	assets := t.TempDir()
+	writeTestPNG(t, filepath.Join(assets, "photos", "photo.png"), 100, 50)
+	g := NewDryRunGenerator(t.TempDir())
+	g.Assets = assets
+	T := &Text{originalFilename: "text.md", raw: []byte("![A photo](/assets/photos/photo.png)\n")}
+
+	body, err := T.HTMLIn(&Feed{gen: g})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `srcset="/assets/photos/photo-40w.png 40w, /assets/photos/photo.png 100w"`) {
+		t.Errorf("rendered %s without a srcset", body)
+	}
+	if len(g.Files) != 0 {
+		t.Errorf("rendering wrote %v", g.Manifest())
+	}
+
+	if err := g.PublishImages(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join("assets", "photos", "photo-40w.png"), filepath.Join("assets", "photos", "photo.png")}
+	for _, fn := range want {
+		if g.Files[fn] == nil {
+			t.Errorf("PublishImages did not write %s; wrote %v", fn, g.Manifest())
+		}
+	}
+	if len(g.Files) != len(want) {
+		t.Errorf("PublishImages wrote %v; want %v", g.Manifest(), want)
+	}
+}
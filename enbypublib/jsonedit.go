@@ -0,0 +1,99 @@
+package enbypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonMember locates a single top-level member of a JSON object within its source.
+type jsonMember struct {
+	key string
+
+	// start and end are the byte offsets of the member's value
+	start, end int
+}
+
+// jsonMembers returns the top-level members of the JSON object in src, in order.
+func jsonMembers(src []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	var members []jsonMember
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %v in JSON object", t)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("cannot read value of %q: %w", key, err)
+		}
+		end := int(dec.InputOffset())
+		members = append(members, jsonMember{key: key, start: end - len(raw), end: end})
+	}
+	return members, nil
+}
+
+// patchJSON sets each of fields on the JSON object in src. Existing members holding a different
+// value have just their value replaced, and missing members are appended after the last member
+// using the indentation of the first. Member order, formatting and line endings are otherwise
+// untouched.
+func patchJSON(src []byte, fields ...metadataField) ([]byte, error) {
+	eol := lineEnding(src)
+	for _, f := range fields {
+		members, err := jsonMembers(src)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := json.Marshal(deref(f.Value))
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %q: %w", f.Key, err)
+		}
+		key, _ := json.Marshal(f.Key)
+
+		var found *jsonMember
+		for i := range members {
+			if members[i].key == f.Key {
+				found = &members[i]
+			}
+		}
+		var B bytes.Buffer
+		switch {
+		case found != nil:
+			raw := src[found.start:found.end]
+			if sameValue(func(v any) error { return json.Unmarshal(raw, v) }, f.Value) {
+				continue
+			}
+			B.Write(src[:found.start])
+			B.Write(enc)
+			B.Write(src[found.end:])
+		case len(members) == 0:
+			open := bytes.IndexByte(src, '{') + 1
+			B.Write(src[:open])
+			fmt.Fprintf(&B, "\n  %s: %s\n", key, enc)
+			B.Write(bytes.TrimLeft(src[open:], " \t\r\n"))
+		default:
+			// indent new members like the first one, and keep them on their own lines if it is
+			first, last := members[0], members[len(members)-1]
+			keyStart := bytes.LastIndexByte(src[:first.start], '"')
+			keyStart = bytes.LastIndexByte(src[:keyStart], '"')
+			lineStart := bytes.LastIndexAny(src[:keyStart], "\n{") + 1
+			sep := []byte(", ")
+			if src[lineStart-1] == '\n' {
+				sep = append([]byte(",\n"), src[lineStart:keyStart]...)
+			}
+			B.Write(src[:last.end])
+			B.Write(sep)
+			fmt.Fprintf(&B, "%s: %s", key, enc)
+			B.Write(src[last.end:])
+		}
+		src = B.Bytes()
+	}
+	return withLineEnding(src, eol), nil
+}
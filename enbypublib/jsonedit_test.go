@@ -0,0 +1,88 @@
+package enbypub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchJSON(t *testing.T) {
+	created := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	title := "New"
+	tests := []struct {
+		name   string
+		src    string
+		fields []metadataField
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			src:    "{\"title\": \"New\", \"created\": \"2024-03-05T12:00:00Z\"}",
+			fields: []metadataField{{"title", &title}, {"created", &created}},
+			want:   "{\"title\": \"New\", \"created\": \"2024-03-05T12:00:00Z\"}",
+		},
+		{
+			name:   "replaced in place",
+			src:    "{\n    \"tags\" : [ \"a\" ],\n    \"title\":\"Old\",\n    \"draft\": true\n}",
+			fields: []metadataField{{"title", `say "hi"`}},
+			want:   "{\n    \"tags\" : [ \"a\" ],\n    \"title\":\"say \\\"hi\\\"\",\n    \"draft\": true\n}",
+		},
+		{
+			name:   "nested object kept",
+			src:    "{\n  \"author\": {\"title\": \"Dr\"},\n  \"title\": \"Old\"\n}",
+			fields: []metadataField{{"title", &title}},
+			want:   "{\n  \"author\": {\"title\": \"Dr\"},\n  \"title\": \"New\"\n}",
+		},
+		{
+			name:   "missing keys indented like the first",
+			src:    "{\n\t\"title\": \"New\",\n\t\"tags\": [\"a\"]\n}",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}, {"created", &created}},
+			want:   "{\n\t\"title\": \"New\",\n\t\"tags\": [\"a\"],\n\t\"slug\": \"new\",\n\t\"created\": \"2024-03-05T12:00:00Z\"\n}",
+		},
+		{
+			name:   "missing keys on one line",
+			src:    "{\"title\": \"New\"}",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "{\"title\": \"New\", \"slug\": \"new\"}",
+		},
+		{
+			name:   "empty object",
+			src:    "{}",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}},
+			want:   "{\n  \"title\": \"New\",\n  \"slug\": \"new\"\n}",
+		},
+		{
+			name:   "escaped html kept escaped",
+			src:    "{\"title\": \"Old\"}",
+			fields: []metadataField{{"title", "a < b"}},
+			want:   "{\"title\": \"a \\u003c b\"}",
+		},
+		{
+			name:   "crlf",
+			src:    "{\r\n  \"title\": \"Old\"\r\n}",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}},
+			want:   "{\r\n  \"title\": \"New\",\r\n  \"slug\": \"new\"\r\n}",
+		},
+		{
+			name:   "crlf empty object",
+			src:    "{\r\n}",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "{\r\n  \"slug\": \"new\"\r\n}",
+		},
+	}
+	for _, tt := range tests {
+		got, err := patchJSON([]byte(tt.src), tt.fields...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: patched\n%q\nto\n%q\nwant\n%q", tt.name, tt.src, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{"[1, 2]", "{\"title\": }", ""} {
+		if got, err := patchJSON([]byte(src), metadataField{"slug", "x"}); err == nil {
+			t.Errorf("patched %q to %q; want an error", src, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package enbypub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// dateNames holds the month and weekday names of a language, in the order of time.Month (from
+// January) and time.Weekday (from Sunday).
+type dateNames struct {
+	months, shortMonths [12]string
+	days, shortDays     [7]string
+}
+
+// localDateLanguages are the languages FormatLocalDate knows names for, matched against the
+// language asked for. English is first, so it's used when nothing matches.
+var localDateLanguages = []language.Tag{
+	language.English, language.German, language.French, language.Spanish, language.Italian,
+	language.Dutch, language.Portuguese, language.Swedish, language.Danish,
+	// Bokmål rather than language.Norwegian, which the matcher finds closer to Danish for "nb"
+	language.MustParse("nb"),
+}
+
+var localDateMatcher = language.NewMatcher(localDateLanguages)
+
+// localDateNames holds the names for each of localDateLanguages after English, which uses the
+// names of the time package.
+var localDateNames = []*dateNames{
+	nil,
+	{ // de
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	},
+	{ // fr
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	{ // es
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	{ // it
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	{ // nl
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+	{ // pt
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:   [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+	{ // sv
+		months:      [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan.", "feb.", "mars", "apr.", "maj", "juni", "juli", "aug.", "sep.", "okt.", "nov.", "dec."},
+		days:        [7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+		shortDays:   [7]string{"sön", "mån", "tis", "ons", "tors", "fre", "lör"},
+	},
+	{ // da
+		months:      [12]string{"januar", "februar", "marts", "april", "maj", "juni", "juli", "august", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "maj", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "dec."},
+		days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		shortDays:   [7]string{"søn.", "man.", "tirs.", "ons.", "tors.", "fre.", "lør."},
+	},
+	{ // no (nb)
+		months:      [12]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"},
+		shortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "mai", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "des."},
+		days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		shortDays:   [7]string{"søn.", "man.", "tir.", "ons.", "tor.", "fre.", "lør."},
+	},
+}
+
+// FormatLocalDate formats t with the Go time layout, like time.Format, but with the month and
+// weekday names (January, Jan, Monday and Mon) of the closest match to lang, a BCP 47 tag. An
+// empty lang means DefaultLanguage. If lang isn't a valid tag or none of localDateLanguages
+// matches it, t is formatted with the English names and an error is returned as well.
+func FormatLocalDate(t time.Time, layout, lang string) (string, error) {
+	if lang == "" {
+		lang = DefaultLanguage
+	}
+	if lang == "" {
+		return t.Format(layout), nil
+	}
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return t.Format(layout), fmt.Errorf("cannot parse language %q: %w", lang, err)
+	}
+	_, i, c := localDateMatcher.Match(tag)
+	if c == language.No {
+		return t.Format(layout), fmt.Errorf("no month and weekday names for language %q", lang)
+	}
+	names := localDateNames[i]
+	if names == nil {
+		return t.Format(layout), nil
+	}
+
+	// Format the layout between the names, as time.Format would find them
+	var B strings.Builder
+	start := 0
+	for i := 0; i < len(layout); i++ {
+		var name string
+		var n int
+		switch rest := layout[i:]; {
+		case strings.HasPrefix(rest, "January"):
+			name, n = names.months[t.Month()-1], 7
+		case strings.HasPrefix(rest, "Jan") && !startsLower(rest[3:]):
+			name, n = names.shortMonths[t.Month()-1], 3
+		case strings.HasPrefix(rest, "Monday"):
+			name, n = names.days[t.Weekday()], 6
+		case strings.HasPrefix(rest, "Mon") && !startsLower(rest[3:]):
+			name, n = names.shortDays[t.Weekday()], 3
+		default:
+			continue
+		}
+		B.WriteString(t.Format(layout[start:i]))
+		B.WriteString(name)
+		start = i + n
+		i = start - 1
+	}
+	B.WriteString(t.Format(layout[start:]))
+	return B.String(), nil
+}
+
+// startsLower reports whether s starts with a lower case ASCII letter, which stops time.Format
+// reading "Jan" or "Mon" as a name (eg in "Month").
+func startsLower(s string) bool {
+	return s != "" && 'a' <= s[0] && s[0] <= 'z'
+}
@@ -0,0 +1,39 @@
+package enbypub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatLocalDate(t *testing.T) {
+	saved := DefaultLanguage
+	t.Cleanup(func() { DefaultLanguage = saved })
+	tm := time.Date(2024, time.March, 5, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		def, lang, layout string
+		want              string
+		err               bool
+	}{
+		{"", "de", "Monday, 2. January 2006", "Dienstag, 5. März 2024", false},
+		{"", "nb", "Mon 2 Jan", "tir. 5 mar.", false},
+		{"", "no", "January", "mars", false},
+		{"", "da", "January", "marts", false},
+		{"", "pt-BR", "January", "março", false},
+		{"", "en-GB", "Monday January", "Tuesday March", false},
+		{"", "", "January", "March", false},
+		{"fr", "", "January", "mars", false},
+		{"fr", "de", "January", "März", false},
+		{"", "de", "Month 1", "Month 3", false},
+		{"", "ja", "January", "March", true},
+		{"ja", "", "January", "March", true},
+		{"", "zh-Hant", "Mon", "Tue", true},
+		{"", "not a tag!", "January", "March", true},
+	}
+	for _, tt := range tests {
+		DefaultLanguage = tt.def
+		got, err := FormatLocalDate(tm, tt.layout, tt.lang)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("FormatLocalDate(%q, %q) with default %q = %q, %v; want %q (error %v)", tt.layout, tt.lang, tt.def, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package enbypub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A MatchError describes a problem parsing a Feed match expression.
+type MatchError struct {
+	// Expr is the complete expression being parsed
+	Expr string
+
+	// Pos is the byte offset into Expr where the problem was found
+	Pos int
+
+	// Msg describes the problem
+	Msg string
+}
+
+func (e *MatchError) Error() string {
+	return fmt.Sprintf("at position %d of %q: %s", e.Pos, e.Expr, e.Msg)
+}
+
+// matchNode is a single node of a parsed match expression.
+type matchNode interface {
+	eval(T *Text) bool
+}
+
+type matchAnd struct{ l, r matchNode }
+type matchOr struct{ l, r matchNode }
+type matchNot struct{ n matchNode }
+
+// matchTag is satisfied when the Text is tagged with tag.
+type matchTag struct{ tag string }
+
+// matchCompare is satisfied when the named field of the Text equals (or, if negate is set,
+// does not equal) value.
+type matchCompare struct {
+	field  string
+	value  string
+	negate bool
+}
+
+func (m matchAnd) eval(T *Text) bool { return m.l.eval(T) && m.r.eval(T) }
+func (m matchOr) eval(T *Text) bool  { return m.l.eval(T) || m.r.eval(T) }
+func (m matchNot) eval(T *Text) bool { return !m.n.eval(T) }
+func (m matchTag) eval(T *Text) bool { return T.IsTagged(m.tag) }
+
+func (m matchCompare) eval(T *Text) bool {
+	if m.field == "tag" || m.field == "tags" {
+		return T.IsTagged(m.value) != m.negate
+	}
+	v, ok := T.field(m.field)
+	if !ok {
+		// a missing field never equals anything
+		return m.negate
+	}
+	return (v == m.value) != m.negate
+}
+
+// isMatchField returns true if name is a field match expressions can compare: "tag", "title" or
+// a known Attribute (see Attribute.IsKnown).
+func isMatchField(name string) bool {
+	switch name {
+	case "tag", "tags", "title":
+		return true
+	}
+	return Attribute(name).IsKnown()
+}
+
+// field returns the value of a named field of T as used by match expressions and template
+// functions: "title", "created" and "modified" (as RFC 3339), or anything T.Get accepts.
+func (T *Text) field(name string) (string, bool) {
+	switch name {
+	case "title":
+		if T.Title != nil {
+			return *T.Title, true
+		}
+		return "", false
+	case "created", "modified":
+		t := T.Created
+		if name == "modified" {
+			t = T.Modified
+		}
+		if t != nil {
+			return t.In(Timezone).Format(time.RFC3339), true
+		}
+		return "", false
+	}
+	s, err := T.Get(Attribute(name))
+	return s, err == nil
+}
+
+type matchTokenKind int
+
+const (
+	matchTokenEOF matchTokenKind = iota
+	matchTokenWord
+	matchTokenString
+	matchTokenAnd
+	matchTokenOr
+	matchTokenNot
+	matchTokenOpen
+	matchTokenClose
+	matchTokenEq
+	matchTokenNe
+)
+
+type matchToken struct {
+	kind matchTokenKind
+	pos  int
+	text string
+}
+
+func (t matchToken) String() string {
+	switch t.kind {
+	case matchTokenEOF:
+		return "end of expression"
+	case matchTokenString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isMatchWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.:/", r)
+}
+
+func lexMatch(expr string) ([]matchToken, error) {
+	var toks []matchToken
+	two := map[string]matchTokenKind{"==": matchTokenEq, "!=": matchTokenNe, "&&": matchTokenAnd, "||": matchTokenOr}
+	one := map[byte]matchTokenKind{'(': matchTokenOpen, ')': matchTokenClose, '!': matchTokenNot}
+	for i := 0; i < len(expr); {
+		r, sz := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += sz
+		case i+1 < len(expr) && two[expr[i:i+2]] != matchTokenEOF:
+			toks = append(toks, matchToken{two[expr[i:i+2]], i, expr[i : i+2]})
+			i += 2
+		case one[expr[i]] != matchTokenEOF:
+			toks = append(toks, matchToken{one[expr[i]], i, expr[i : i+1]})
+			i++
+		case r == '"' || r == '\'':
+			var s strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != expr[i]; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				s.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, &MatchError{Expr: expr, Pos: i, Msg: "unterminated string"}
+			}
+			toks = append(toks, matchToken{matchTokenString, i, s.String()})
+			i = j + 1
+		case isMatchWordRune(r):
+			j := i
+			for j < len(expr) {
+				r, sz := utf8.DecodeRuneInString(expr[j:])
+				if !isMatchWordRune(r) {
+					break
+				}
+				j += sz
+			}
+			w := matchToken{matchTokenWord, i, expr[i:j]}
+			switch strings.ToUpper(w.text) {
+			case "AND":
+				w.kind = matchTokenAnd
+			case "OR":
+				w.kind = matchTokenOr
+			case "NOT":
+				w.kind = matchTokenNot
+			}
+			toks = append(toks, w)
+			i = j
+		default:
+			return nil, &MatchError{Expr: expr, Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, matchToken{matchTokenEOF, len(expr), ""}), nil
+}
+
+type matchParser struct {
+	expr string
+	toks []matchToken
+	i    int
+}
+
+func (p *matchParser) peek() matchToken {
+	return p.toks[p.i]
+}
+
+func (p *matchParser) next() matchToken {
+	t := p.toks[p.i]
+	if t.kind != matchTokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *matchParser) errorf(t matchToken, format string, a ...any) error {
+	return &MatchError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+// parseOr handles the lowest precedence operator, OR.
+func (p *matchParser) parseOr() (matchNode, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == matchTokenOr {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = matchOr{l, r}
+	}
+	return l, nil
+}
+
+func (p *matchParser) parseAnd() (matchNode, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == matchTokenAnd {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = matchAnd{l, r}
+	}
+	return l, nil
+}
+
+func (p *matchParser) parseNot() (matchNode, error) {
+	if p.peek().kind == matchTokenNot {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return matchNot{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *matchParser) parsePrimary() (matchNode, error) {
+	t := p.next()
+	switch t.kind {
+	case matchTokenOpen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != matchTokenClose {
+			return nil, p.errorf(c, "expected \")\" to close \"(\" at position %d, found %v", t.pos, c)
+		}
+		return n, nil
+	case matchTokenWord, matchTokenString:
+		op := p.peek()
+		if op.kind != matchTokenEq && op.kind != matchTokenNe {
+			return matchTag{t.text}, nil
+		}
+		if t.kind != matchTokenWord {
+			return nil, p.errorf(t, "expected a field name before %v, found %v", op, t)
+		}
+		if !isMatchField(strings.ToLower(t.text)) {
+			return nil, p.errorf(t, "unknown field %q (front matter fields are written %s%s)", t.text, TextAttributeParamPrefix, t.text)
+		}
+		p.next()
+		v := p.next()
+		if v.kind != matchTokenWord && v.kind != matchTokenString {
+			return nil, p.errorf(v, "expected a value after %v, found %v", op, v)
+		}
+		return matchCompare{field: strings.ToLower(t.text), value: v.text, negate: op.kind == matchTokenNe}, nil
+	}
+	return nil, p.errorf(t, "expected a tag, comparison or \"(\", found %v", t)
+}
+
+// parseMatch parses a boolean match expression. Bare words match Texts tagged with that
+// word; `field == "value"` and `field != "value"` compare against Text attributes, with front
+// matter fields written with TextAttributeParamPrefix (eg `param.style == "note"`). Terms
+// can be combined with AND, OR, NOT (or &&, ||, !) and grouped with parentheses.
+func parseMatch(expr string) (matchNode, error) {
+	toks, err := lexMatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &matchParser{expr: expr, toks: toks}
+	if p.peek().kind == matchTokenEOF {
+		return nil, p.errorf(p.peek(), "expression is empty")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != matchTokenEOF {
+		return nil, p.errorf(t, "unexpected %v", t)
+	}
+	return n, nil
+}
+
+// A Match is a parsed match expression, as used by Feed.Match, for selecting Texts elsewhere.
+type Match struct {
+	n matchNode
+}
+
+// ParseMatch parses a match expression; see Feed.Match for the syntax.
+func ParseMatch(expr string) (*Match, error) {
+	n, err := parseMatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Match{n}, nil
+}
+
+// Matches reports whether T satisfies the expression.
+func (m *Match) Matches(T *Text) bool {
+	return m.n.eval(T)
+}
@@ -0,0 +1,123 @@
+package enbypub
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMatch(t *testing.T) {
+	a, b, c := matchTag{"a"}, matchTag{"b"}, matchTag{"c"}
+	tests := []struct {
+		expr string
+		want matchNode
+	}{
+		{"a", a},
+		{"a OR b AND c", matchOr{a, matchAnd{b, c}}},
+		{"a AND b OR c", matchOr{matchAnd{a, b}, c}},
+		{"a || b && c", matchOr{a, matchAnd{b, c}}},
+		{"a and b or c", matchOr{matchAnd{a, b}, c}},
+		{"(a OR b) AND c", matchAnd{matchOr{a, b}, c}},
+		{"((a) OR (b AND (c)))", matchOr{a, matchAnd{b, c}}},
+		{"a OR b OR c", matchOr{matchOr{a, b}, c}},
+		{"NOT a AND b", matchAnd{matchNot{a}, b}},
+		{"!a || !(b && c)", matchOr{matchNot{a}, matchNot{matchAnd{b, c}}}},
+		{"NOT NOT a", matchNot{matchNot{a}}},
+		{`"a"`, a},
+		{`"two words"`, matchTag{"two words"}},
+		{"go-1.22 AND docs/how_to:v2", matchAnd{matchTag{"go-1.22"}, matchTag{"docs/how_to:v2"}}},
+		{"étoile", matchTag{"étoile"}},
+		{`title == "Hello"`, matchCompare{field: "title", value: "Hello"}},
+		{`Title == Hello`, matchCompare{field: "title", value: "Hello"}},
+		{`slug != 'first'`, matchCompare{field: "slug", value: "first", negate: true}},
+		{`tag == a`, matchCompare{field: "tag", value: "a"}},
+		{`param.style == note`, matchCompare{field: "param.style", value: "note"}},
+		{`title == "say \"hi\""`, matchCompare{field: "title", value: `say "hi"`}},
+		{`title == 'it\'s'`, matchCompare{field: "title", value: "it's"}},
+		{`title == "back\\slash"`, matchCompare{field: "title", value: `back\slash`}},
+		{`a AND NOT slug != x`, matchAnd{a, matchNot{matchCompare{field: "slug", value: "x", negate: true}}}},
+	}
+	for _, tt := range tests {
+		got, err := parseMatch(tt.expr)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMatch(%q) = %#v, %v; want %#v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseMatchErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 0, "expression is empty"},
+		{"   ", 3, "expression is empty"},
+		{`title == "open`, 9, "unterminated string"},
+		{`'open`, 0, "unterminated string"},
+		{`title == "escaped\"`, 9, "unterminated string"},
+		{"a AND", 5, "expected a tag"},
+		{"a b", 2, `unexpected "b"`},
+		{"(a OR b", 7, `expected ")" to close "(" at position 0`},
+		{"a OR b)", 6, `unexpected ")"`},
+		{"()", 1, "expected a tag"},
+		{"a & b", 2, "unexpected character '&'"},
+		{"c++", 1, "unexpected character '+'"},
+		{"a == b", 0, `unknown field "a"`},
+		{"style == note", 0, "written param.style"},
+		{"x AND titel != y", 6, `unknown field "titel"`},
+		{`"title" == x`, 0, "expected a field name"},
+		{"title ==", 8, "expected a value"},
+		{"title == (x)", 9, "expected a value"},
+	}
+	for _, tt := range tests {
+		_, err := parseMatch(tt.expr)
+		var me *MatchError
+		if !errors.As(err, &me) {
+			t.Errorf("parseMatch(%q) = %v; want a MatchError", tt.expr, err)
+			continue
+		}
+		if me.Pos != tt.pos || !strings.Contains(me.Msg, tt.msg) {
+			t.Errorf("parseMatch(%q) failed at %d with %q; want %d with %q", tt.expr, me.Pos, me.Msg, tt.pos, tt.msg)
+		}
+		if me.Expr != tt.expr {
+			t.Errorf("parseMatch(%q) error has expression %q", tt.expr, me.Expr)
+		}
+	}
+}
+
+func TestMatchMatches(t *testing.T) {
+	texts := testTexts()
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"public", []string{"Alpha", "Bravo"}},
+		{"public AND travel", []string{"Alpha"}},
+		{"public OR travel", []string{"Alpha", "Bravo", "Charlie"}},
+		{"NOT public", []string{"Charlie"}},
+		{"travel AND NOT public OR title == Bravo", []string{"Bravo", "Charlie"}},
+		{"travel AND NOT (public OR title == Bravo)", []string{"Charlie"}},
+		{"param.category == food", []string{"Bravo"}},
+		// a missing field never equals anything, so it's always not equal
+		{"param.category != food", []string{"Alpha", "Charlie"}},
+		{"tag != travel", []string{"Bravo"}},
+	}
+	for _, tt := range tests {
+		m, err := ParseMatch(tt.expr)
+		if err != nil {
+			t.Errorf("ParseMatch(%q): %v", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, T := range texts {
+			if m.Matches(T) {
+				got = append(got, *T.Title)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q matches %q; want %q", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package enbypub
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MetadataDescriptionLength is the maximum length of a description generated from a Text body.
+var MetadataDescriptionLength = 160
+
+// AbsURL returns p (a path relative to the public root) as an absolute URL if the Generator has a
+// BaseURL, or as a root-relative path otherwise.
+func (g *Generator) AbsURL(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	if g == nil || g.BaseURL == nil {
+		return "/" + p
+	}
+	return g.BaseURL.JoinPath(p).String()
+}
+
+// IsRobotsExcluded returns true if this Feed asks search engines not to index its Texts.
+func (F *Feed) IsRobotsExcluded() bool {
+	for _, a := range F.Aggregators {
+		if _, ok := a.(*RobotsExcludeAggregator); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Description returns the description, summary or excerpt front matter field of T, or failing
+// that the start of its body as plain text. It's empty if the body can't be rendered.
+func (T *Text) Description() string {
+	for _, p := range []string{"description", "summary", "excerpt"} {
+		if d, ok := T.Param(p); ok && d != "" {
+			return d
+		}
+	}
+	body, err := T.HTML()
+	if err != nil {
+		return ""
+	}
+	return Truncate(PlainText(string(body)), MetadataDescriptionLength)
+}
+
+var htmlBlockTag = regexp.MustCompile(`(?i)</?(?:p|div|br|hr|li|ul|ol|dl|dt|dd|h[1-6]|pre|blockquote|table|tr|td|th|section|article|figure|figcaption)\b[^>]*>`)
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+var whitespace = regexp.MustCompile(`\s+`)
+
+// PlainText strips tags from an HTML fragment and collapses its whitespace.
+func PlainText(frag string) string {
+	frag = htmlTag.ReplaceAllString(htmlBlockTag.ReplaceAllString(frag, " "), "")
+	return strings.TrimSpace(whitespace.ReplaceAllString(html.UnescapeString(frag), " "))
+}
+
+// Truncate shortens s to at most n runes, breaking at a word boundary and adding an ellipsis if
+// anything was removed.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	cut := string(r[:n])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// Metadata returns the <head> elements describing T as published in F: a canonical link, hreflang
+// alternate links to its translations, Open Graph and Twitter card properties, a schema.org
+// BlogPosting in JSON-LD (or another type such as Article, from the schematype front matter
+// field), and a robots noindex directive if F is excluded from search engines.
+func Metadata(F *Feed, T *Text) (template.HTML, error) {
+	p := F.GetURL(T.Id.String())
+	if p == "" {
+		return "", fmt.Errorf("text %v is not published in feed %v", T, F.Slug)
+	}
+	url := F.gen.AbsURL(p)
+
+	var title string
+	if T.Title != nil {
+		title = *T.Title
+	}
+	desc := T.Description()
+	image, _ := T.Param("image")
+	if image == "" {
+		image = T.SocialCardIn(F)
+	}
+	if image != "" && !strings.Contains(image, "://") {
+		image = F.gen.AbsURL(image)
+	}
+	author, _ := T.Param("author")
+
+	var B strings.Builder
+	tag := func(attr, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&B, "<meta %s=\"%s\" content=\"%s\">\n", attr, name, html.EscapeString(content))
+		}
+	}
+	fmt.Fprintf(&B, "<link rel=\"canonical\" href=\"%s\">\n", html.EscapeString(url))
+	if S := F.gen.Site; S != nil && T.Language() != "" {
+		alternate := func(lang, href string) {
+			fmt.Fprintf(&B, "<link rel=\"alternate\" hreflang=\"%s\" href=\"%s\">\n", html.EscapeString(lang), html.EscapeString(href))
+		}
+		if ls := S.TranslationLinks(T); len(ls) > 0 {
+			alternate(T.Language(), url)
+			for _, l := range ls {
+				alternate(l.Lang, F.gen.AbsURL(l.URL))
+			}
+		}
+	}
+	if F.IsRobotsExcluded() {
+		tag("name", "robots", "noindex")
+	}
+	tag("name", "description", desc)
+	tag("property", "og:type", "article")
+	tag("property", "og:title", title)
+	tag("property", "og:description", desc)
+	tag("property", "og:url", url)
+	tag("property", "og:image", image)
+	if T.Created != nil {
+		tag("property", "article:published_time", T.Created.In(Timezone).Format(time.RFC3339))
+	}
+	if T.Modified != nil {
+		tag("property", "article:modified_time", T.Modified.In(Timezone).Format(time.RFC3339))
+	}
+	if author != "" {
+		tag("property", "article:author", author)
+	}
+	for _, t := range T.Tags {
+		tag("property", "article:tag", t)
+	}
+	if image != "" {
+		tag("name", "twitter:card", "summary_large_image")
+	} else {
+		tag("name", "twitter:card", "summary")
+	}
+	tag("name", "twitter:title", title)
+	tag("name", "twitter:description", desc)
+	tag("name", "twitter:image", image)
+
+	schema, _ := T.Param("schematype")
+	if schema == "" {
+		schema = "BlogPosting"
+	}
+	ld := map[string]any{
+		"@context":         "https://schema.org",
+		"@type":            schema,
+		"headline":         title,
+		"url":              url,
+		"mainEntityOfPage": map[string]any{"@type": "WebPage", "@id": url},
+	}
+	if desc != "" {
+		ld["description"] = desc
+	}
+	if T.Created != nil {
+		ld["datePublished"] = T.Created.In(Timezone).Format(time.RFC3339)
+	}
+	if T.Modified != nil {
+		ld["dateModified"] = T.Modified.In(Timezone).Format(time.RFC3339)
+	}
+	if author != "" {
+		ld["author"] = map[string]any{"@type": "Person", "name": author}
+	}
+	if image != "" {
+		ld["image"] = image
+	}
+	if lang := T.Language(); lang != "" {
+		ld["inLanguage"] = lang
+	}
+	if len(T.Tags) > 0 {
+		ld["keywords"] = strings.Join(T.Tags, ", ")
+	}
+	// json.Marshal escapes <, > and &, so the result can't close the script element early
+	b, err := json.Marshal(ld)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode JSON-LD for %v: %w", T, err)
+	}
+	fmt.Fprintf(&B, "<script type=\"application/ld+json\">%s</script>\n", b)
+	return template.HTML(B.String()), nil
+}
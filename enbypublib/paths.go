@@ -2,12 +2,27 @@ package enbypub
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 )
 
 // A PathComponent describes a static string, an attribute of a published Text, or an attribute of the Feed
 type PathComponent struct {
 	String *string    `yaml:",omitempty"`
 	Attr   *Attribute `yaml:",omitempty"`
+
+	// Format, if set, is a Go time layout the Attr is formatted with, eg "2006/01". Attr must be a
+	// time: created, modified, or a front matter field holding a time.
+	Format *string `yaml:",omitempty"`
+
+	// Transform lists changes made to the value in order: "lowercase", "slugify" or "truncate"
+	Transform []string `yaml:",omitempty"`
+
+	// MaxLength is the length in characters that the "truncate" Transform cuts the value to, at
+	// a word boundary if there is one
+	MaxLength *int `yaml:",omitempty"`
 }
 
 type Attribute string
@@ -22,22 +37,147 @@ const (
 	TextAttributeDay       = Attribute("day")
 	TextAttributeDayOfWeek = Attribute("dow")
 	TextAttributeYMD       = Attribute("date")
+	TextAttributeMonthName = Attribute("monthname") // eg "january"
+	TextAttributeISOWeek   = Attribute("isoweek")   // eg "2024-W09"
+	TextAttributeQuarter   = Attribute("quarter")   // eg "q1"
+
+	// TextAttributeCreated and TextAttributeModified are dates formatted as 2006-01-02, or with
+	// the PathComponent Format
+	TextAttributeCreated  = Attribute("created")
+	TextAttributeModified = Attribute("modified")
+
+	TextAttributeModifiedYear  = Attribute("modyear")
+	TextAttributeModifiedMonth = Attribute("modmonth")
+	TextAttributeModifiedDay   = Attribute("modday")
+	TextAttributeModifiedYMD   = Attribute("moddate")
+
+	TextAttributeFirstTag  = Attribute("tag")       // the first tag, slugified
+	TextAttributeShortId   = Attribute("shortid")   // the first 8 characters of the id
+	TextAttributeTitleSlug = Attribute("titleslug") // the title slugified, even if the slug is set
+	TextAttributeLang      = Attribute("lang")      // the language of the Text as written, eg "de"; see Text.Language
 
 	FeedAttributeSlug = Attribute("feedslug")
 	FeedAttributeId   = Attribute("feedid")
 )
 
+// KnownAttributes lists every Attribute with a built in meaning.
+var KnownAttributes = []Attribute{
+	TextAttributeSlug, TextAttributeId, TextAttributeTemplate,
+	TextAttributeYear, TextAttributeMonth, TextAttributeDay, TextAttributeDayOfWeek, TextAttributeYMD,
+	TextAttributeMonthName, TextAttributeISOWeek, TextAttributeQuarter, TextAttributeCreated, TextAttributeModified,
+	TextAttributeModifiedYear, TextAttributeModifiedMonth, TextAttributeModifiedDay, TextAttributeModifiedYMD,
+	TextAttributeFirstTag, TextAttributeShortId, TextAttributeTitleSlug, TextAttributeLang,
+	FeedAttributeSlug, FeedAttributeId,
+}
+
+// IsKnown returns true if a is one of KnownAttributes or names a front matter field with
+// TextAttributeParamPrefix. No other Attribute has a value.
+func (a Attribute) IsKnown() bool {
+	return slices.Contains(KnownAttributes, a) || strings.HasPrefix(string(a), TextAttributeParamPrefix)
+}
+
+// ErrUnknownAttribute is wrapped by the error Feed.Validate returns for an Attribute that isn't
+// known (see Attribute.IsKnown), eg a misspelling or a front matter field without
+// TextAttributeParamPrefix.
+var ErrUnknownAttribute = errors.New("unknown attribute")
+
+// PathTransforms lists the names allowed in PathComponent.Transform.
+var PathTransforms = []string{"lowercase", "slugify", "truncate"}
+
+// Validate returns an error if pc doesn't define exactly one of String and Attr, or its Format,
+// Transform or MaxLength can't be used.
+func (pc PathComponent) Validate() error {
+	switch {
+	case pc.String != nil && pc.Attr != nil:
+		return errors.New("path component defines both an attribute and a string")
+	case pc.String == nil && pc.Attr == nil:
+		return errors.New("path component does not define any values")
+	}
+	if pc.Format != nil {
+		if pc.Attr == nil || !pc.Attr.isTime() {
+			return fmt.Errorf("format can only be used with %q, %q or a %s field holding a time",
+				TextAttributeCreated, TextAttributeModified, TextAttributeParamPrefix)
+		}
+		if v := pathFormatCheck.Format(*pc.Format); v == *pc.Format || strings.Contains(v, "..") || strings.HasPrefix(v, "/") {
+			return fmt.Errorf("format %q is not a usable time layout (see https://pkg.go.dev/time#Layout)", *pc.Format)
+		}
+	}
+	truncate := false
+	for _, t := range pc.Transform {
+		if !slices.Contains(PathTransforms, t) {
+			return fmt.Errorf("unknown transform %q (expected one of %s)", t, strings.Join(PathTransforms, ", "))
+		}
+		truncate = truncate || t == "truncate"
+	}
+	switch {
+	case truncate && (pc.MaxLength == nil || *pc.MaxLength < 1):
+		return errors.New("the truncate transform needs a maxlength of at least 1")
+	case !truncate && pc.MaxLength != nil:
+		return errors.New("maxlength is only used by the truncate transform")
+	}
+	return nil
+}
+
+// pathFormatCheck is formatted with a PathComponent Format to check that the layout does anything.
+var pathFormatCheck = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+// isTime returns true if a is a time, which can be formatted with a PathComponent Format.
+func (a Attribute) isTime() bool {
+	return a == TextAttributeCreated || a == TextAttributeModified || strings.HasPrefix(string(a), TextAttributeParamPrefix)
+}
+
+// TextAttributeParamPrefix is prepended to the name of an arbitrary front matter field to use it
+// as an Attribute, eg `attr: param.category`.
+const TextAttributeParamPrefix = "param."
+
 func (pc PathComponent) Get(F *Feed, T *Text) (string, error) {
 	if pc.String != nil && pc.Attr != nil {
 		return "", errors.New("path component defines both an attribute and a string")
 	}
 
+	var v string
+	var err error
 	switch {
 	case pc.String != nil:
-		return *pc.String, nil
+		v = *pc.String
+	case pc.Attr != nil && pc.Format != nil:
+		var t time.Time
+		if t, err = T.Time(*pc.Attr); err == nil {
+			v = t.In(Timezone).Format(*pc.Format)
+		}
 	case pc.Attr != nil:
-		return F.Get(*pc.Attr, T)
+		v, err = F.Get(*pc.Attr, T)
+	default:
+		return "", errors.New("path component does not define any values")
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, t := range pc.Transform {
+		switch t {
+		case "lowercase":
+			v = strings.ToLower(v)
+		case "slugify":
+			v = *Sluggify(&v)
+		case "truncate":
+			v = truncatePath(v, *pc.MaxLength)
+		}
 	}
+	return v, nil
+}
 
-	return "", errors.New("path component does not define any values")
+// truncatePath cuts s to at most n characters, at the last "-" or "_" if there is one so that
+// words aren't split.
+func truncatePath(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	cut := string(r[:n])
+	if r[n] != '-' && r[n] != '_' {
+		if i := strings.LastIndexAny(cut, "-_"); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, "-_")
 }
@@ -1 +1,233 @@
 package enbypub
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	md "github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	mdhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// A Renderer converts the raw body of a Text into an HTML fragment.
+type Renderer interface {
+	Render(src []byte, w io.Writer) error
+}
+
+// RendererFunc adapts an ordinary function to a Renderer.
+type RendererFunc func(src []byte, w io.Writer) error
+
+func (f RendererFunc) Render(src []byte, w io.Writer) error {
+	return f(src, w)
+}
+
+// renderers maps a lower case file extension (without a leading dot) to its Renderer.
+var renderers = map[string]Renderer{
+	"md":       RendererFunc(RenderMarkdown),
+	"markdown": RendererFunc(RenderMarkdown),
+	"txt":      RendererFunc(RenderPlainText),
+	"html":     RendererFunc(RenderHTML),
+	"htm":      RendererFunc(RenderHTML),
+	"gmi":      RendererFunc(RenderGemtext),
+}
+
+// RegisterRenderer sets the Renderer used for Texts read from files with extension ext, replacing
+// any existing Renderer for that extension.
+func RegisterRenderer(ext string, r Renderer) {
+	renderers[strings.ToLower(strings.TrimLeft(ext, "."))] = r
+}
+
+// RendererFor returns the Renderer for the file fn based on its extension, or nil if there isn't
+// one registered.
+func RendererFor(fn string) Renderer {
+	return renderers[strings.ToLower(strings.TrimLeft(filepath.Ext(fn), "."))]
+}
+
+// RendererExtensions returns a sorted list of every extension with a registered Renderer.
+func RendererExtensions() []string {
+	exts := make([]string, 0, len(renderers))
+	for ext := range renderers {
+		exts = append(exts, ext)
+	}
+	slices.Sort(exts)
+	return exts
+}
+
+// RendererPattern returns a regular expression matching filenames with any registered extension.
+func RendererPattern() *regexp.Regexp {
+	exts := RendererExtensions()
+	for i := range exts {
+		exts[i] = regexp.QuoteMeta(exts[i])
+	}
+	return regexp.MustCompile(`(?i)\.(` + strings.Join(exts, "|") + `)$`)
+}
+
+// MarkdownOptionsT controls how Markdown is rendered.
+type MarkdownOptionsT struct {
+	// GFM enables the GitHub Flavored Markdown extensions: tables, strikethrough, autolinks and
+	// task lists
+	GFM bool
+
+	// Typographer replaces quotes, dashes and ellipses with their typographic equivalents
+	Typographer bool
+
+	// HardWraps renders every newline in a paragraph as a line break
+	HardWraps bool
+
+	// Unsafe passes raw HTML in Markdown through to the output; otherwise it's omitted
+	Unsafe bool
+}
+
+// MarkdownOptions is used for every Text rendered by RenderMarkdown.
+var MarkdownOptions MarkdownOptionsT
+
+// markdown is the converter for markdownFor; it's rebuilt when MarkdownOptions changes.
+var markdown struct {
+	opts MarkdownOptionsT
+	md   md.Markdown
+}
+
+func markdownFor(opts MarkdownOptionsT) md.Markdown {
+	if markdown.md != nil && markdown.opts == opts {
+		return markdown.md
+	}
+	var exts []md.Extender
+	if opts.GFM {
+		exts = append(exts, extension.GFM)
+	}
+	if opts.Typographer {
+		exts = append(exts, extension.Typographer)
+	}
+	var ropts []renderer.Option
+	if opts.HardWraps {
+		ropts = append(ropts, mdhtml.WithHardWraps())
+	}
+	if opts.Unsafe {
+		ropts = append(ropts, mdhtml.WithUnsafe())
+	}
+	markdown.opts, markdown.md = opts, md.New(md.WithExtensions(exts...), md.WithRendererOptions(ropts...))
+	return markdown.md
+}
+
+// RenderMarkdown renders CommonMark Markdown according to MarkdownOptions.
+func RenderMarkdown(src []byte, w io.Writer) error {
+	return markdownFor(MarkdownOptions).Convert(src, w)
+}
+
+// RenderHTML passes an HTML fragment through unchanged.
+func RenderHTML(src []byte, w io.Writer) error {
+	_, err := w.Write(src)
+	return err
+}
+
+// plainTextParagraphBreak matches the blank lines between paragraphs of plain text.
+var plainTextParagraphBreak = regexp.MustCompile(`\r?\n(?:[ \t]*\r?\n)+`)
+
+// RenderPlainText renders plain text as paragraphs separated by blank lines. Paragraphs where
+// every line is indented are treated as preformatted.
+func RenderPlainText(src []byte, w io.Writer) error {
+	var B bytes.Buffer
+	for _, para := range plainTextParagraphBreak.Split(string(src), -1) {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(para, "\r\n"), "\n")
+		pre := true
+		for _, l := range lines {
+			if !strings.HasPrefix(l, " ") && !strings.HasPrefix(l, "\t") {
+				pre = false
+				break
+			}
+		}
+		if pre {
+			fmt.Fprintf(&B, "<pre>%s</pre>\n", html.EscapeString(strings.Join(lines, "\n")))
+			continue
+		}
+		for i := range lines {
+			lines[i] = html.EscapeString(strings.TrimSpace(lines[i]))
+		}
+		fmt.Fprintf(&B, "<p>%s</p>\n", strings.Join(lines, "\n"))
+	}
+	_, err := B.WriteTo(w)
+	return err
+}
+
+// RenderGemtext renders Gemini gemtext (text/gemini) documents.
+func RenderGemtext(src []byte, w io.Writer) error {
+	var B bytes.Buffer
+	var pre, list bool
+	s := bufio.NewScanner(bytes.NewReader(src))
+	// a line may be as long as the whole document
+	s.Buffer(nil, len(src)+1)
+	for s.Scan() {
+		l := strings.TrimRight(s.Text(), "\r")
+		if pre {
+			if strings.HasPrefix(l, "```") {
+				B.WriteString("</pre>\n")
+				pre = false
+				continue
+			}
+			B.WriteString(html.EscapeString(l) + "\n")
+			continue
+		}
+		if list && !strings.HasPrefix(l, "* ") {
+			B.WriteString("</ul>\n")
+			list = false
+		}
+		switch {
+		case strings.HasPrefix(l, "```"):
+			if alt := strings.TrimSpace(l[3:]); alt != "" {
+				fmt.Fprintf(&B, "<pre aria-label=\"%s\">", html.EscapeString(alt))
+			} else {
+				B.WriteString("<pre>")
+			}
+			pre = true
+		case strings.HasPrefix(l, "=>"):
+			f := strings.Fields(l[2:])
+			if len(f) == 0 {
+				continue
+			}
+			label := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l[2:]), f[0]))
+			if label == "" {
+				label = f[0]
+			}
+			fmt.Fprintf(&B, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(f[0]), html.EscapeString(label))
+		case strings.HasPrefix(l, "###"):
+			fmt.Fprintf(&B, "<h3>%s</h3>\n", html.EscapeString(strings.TrimSpace(l[3:])))
+		case strings.HasPrefix(l, "##"):
+			fmt.Fprintf(&B, "<h2>%s</h2>\n", html.EscapeString(strings.TrimSpace(l[2:])))
+		case strings.HasPrefix(l, "#"):
+			fmt.Fprintf(&B, "<h1>%s</h1>\n", html.EscapeString(strings.TrimSpace(l[1:])))
+		case strings.HasPrefix(l, "* "):
+			if !list {
+				B.WriteString("<ul>\n")
+				list = true
+			}
+			fmt.Fprintf(&B, "<li>%s</li>\n", html.EscapeString(strings.TrimSpace(l[2:])))
+		case strings.HasPrefix(l, ">"):
+			fmt.Fprintf(&B, "<blockquote>%s</blockquote>\n", html.EscapeString(strings.TrimSpace(l[1:])))
+		case strings.TrimSpace(l) == "":
+		default:
+			fmt.Fprintf(&B, "<p>%s</p>\n", html.EscapeString(l))
+		}
+	}
+	if pre {
+		B.WriteString("</pre>\n")
+	}
+	if list {
+		B.WriteString("</ul>\n")
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	_, err := B.WriteTo(w)
+	return err
+}
@@ -0,0 +1,147 @@
+package enbypub
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+)
+
+// Series names the multi-part series a Text is a part of. In front matter it's written as the
+// name alone (`series: Learning Go`) or with the place of the Text in the series
+// (`series: {name: Learning Go, order: 2}`).
+type Series struct {
+	Name string
+
+	// Order places the Text among the parts of the series, lowest first. Parts without an Order
+	// are placed among those with one by Created, so a part written after part 2 (and before
+	// part 3) comes between them.
+	Order *int `yaml:",omitempty"`
+}
+
+func (s *Series) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		s.Name = name
+		return nil
+	}
+	type plain Series
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Name == "" {
+		return errors.New("series needs a name")
+	}
+	return nil
+}
+
+// sortSeriesParts orders the parts of a series in place. Parts with an Order are sorted by it
+// (then by Created), and each part without an Order is placed among them by Created: before the
+// first ordered part created after it, or after them all.
+func sortSeriesParts(parts []*Text) {
+	var ordered, unordered []*Text
+	for _, t := range parts {
+		if t.Series.Order != nil {
+			ordered = append(ordered, t)
+		} else {
+			unordered = append(unordered, t)
+		}
+	}
+	slices.SortStableFunc(ordered, func(a, b *Text) int {
+		return cmp.Or(cmp.Compare(*a.Series.Order, *b.Series.Order), a.Created.Compare(*b.Created))
+	})
+	slices.SortStableFunc(unordered, func(a, b *Text) int { return a.Created.Compare(*b.Created) })
+	parts = parts[:0]
+	for len(ordered) > 0 && len(unordered) > 0 {
+		if unordered[0].Created.Before(*ordered[0].Created) {
+			parts, unordered = append(parts, unordered[0]), unordered[1:]
+		} else {
+			parts, ordered = append(parts, ordered[0]), ordered[1:]
+		}
+	}
+	parts = append(parts, ordered...)
+	parts = append(parts, unordered...)
+}
+
+// InSeries reports whether T is a part of the series named name.
+func (T *Text) InSeries(name string) bool {
+	return T.Series != nil && T.Series.Name == name
+}
+
+// Adjacent returns the Texts published in F just before (older than) and just after (newer than)
+// T, or nil at either end. F.Index must be sorted with SortByCreatedDescending, as NewSite leaves
+// it.
+func (F *Feed) Adjacent(T *Text) (prev, next *Text) {
+	i := slices.Index(F.Index, T)
+	if i < 0 {
+		return nil, nil
+	}
+	if i+1 < len(F.Index) {
+		prev = F.Index[i+1]
+	}
+	if i > 0 {
+		next = F.Index[i-1]
+	}
+	return prev, next
+}
+
+// SeriesParts returns the Texts in F that are parts of the series named name, in order.
+func (F *Feed) SeriesParts(name string) []*Text {
+	var parts []*Text
+	for _, T := range F.Index {
+		if T.InSeries(name) {
+			parts = append(parts, T)
+		}
+	}
+	sortSeriesParts(parts)
+	return parts
+}
+
+// A SeriesPosition is the place of a Text among the parts of its series published in a Feed.
+type SeriesPosition struct {
+	// Name is the name of the series
+	Name string
+
+	// Parts lists the parts of the series in the Feed, in order
+	Parts []*Text
+
+	// Part is the place of the Text in Parts, counting from 1
+	Part int
+
+	// Prev and Next are the parts before and after the Text, or nil
+	Prev, Next *Text
+
+	// URL is the root-relative URL of the series page, if the Feed has a series aggregator
+	URL string
+}
+
+// SeriesPosition returns the place of T in its series in F, or nil if T isn't part of a series
+// or isn't published in F.
+func (F *Feed) SeriesPosition(T *Text) *SeriesPosition {
+	if T.Series == nil {
+		return nil
+	}
+	parts := F.SeriesParts(T.Series.Name)
+	i := slices.Index(parts, T)
+	if i < 0 {
+		return nil
+	}
+	sp := &SeriesPosition{Name: T.Series.Name, Parts: parts, Part: i + 1, URL: F.SeriesURL(T.Series.Name)}
+	if i > 0 {
+		sp.Prev = parts[i-1]
+	}
+	if i+1 < len(parts) {
+		sp.Next = parts[i+1]
+	}
+	return sp
+}
+
+// SeriesURL returns the root-relative URL of the page the first series aggregator of F renders for
+// the series named name, or an empty string if F has no series aggregator.
+func (F *Feed) SeriesURL(name string) string {
+	for _, a := range F.Aggregators {
+		if sa, ok := a.(*SeriesAggregator); ok {
+			return "/" + URLStyleDirectory.url(sa.location(name))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package enbypub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortSeriesParts(t *testing.T) {
+	// part returns a part created on day of March 2024, with the order if it isn't 0
+	part := func(title string, day, order int) *Text {
+		created := time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC)
+		T := &Text{Title: strptr(title), Created: &created, Series: &Series{Name: "Learning Go"}}
+		if order != 0 {
+			T.Series.Order = &order
+		}
+		return T
+	}
+	tests := []struct {
+		name  string
+		parts []*Text
+		want  []string
+	}{
+		{
+			"by order",
+			[]*Text{part("3", 1, 3), part("1", 2, 1), part("2", 3, 2)},
+			[]string{"1", "2", "3"},
+		},
+		{
+			"by created",
+			[]*Text{part("c", 3, 0), part("a", 1, 0), part("b", 2, 0)},
+			[]string{"a", "b", "c"},
+		},
+		{
+			"unordered between ordered",
+			[]*Text{part("1", 1, 1), part("3", 5, 3), part("aside", 3, 0), part("2", 2, 2)},
+			[]string{"1", "2", "aside", "3"},
+		},
+		{
+			"unordered before and after",
+			[]*Text{part("1", 2, 1), part("late", 9, 0), part("2", 3, 2), part("intro", 1, 0)},
+			[]string{"intro", "1", "2", "late"},
+		},
+		{
+			"ordered out of date order",
+			[]*Text{part("1", 5, 1), part("2", 2, 2), part("aside", 3, 0)},
+			[]string{"aside", "1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		sortSeriesParts(tt.parts)
+		if got := titles(tt.parts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sorted to %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
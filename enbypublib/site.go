@@ -0,0 +1,258 @@
+package enbypub
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Site describes everything being published, so that templates can look beyond the Feed and Text
+// they are rendering (eg for navigation menus, or linking to a Text by id).
+type Site struct {
+	// Feeds holds every Feed by its Slug
+	Feeds map[string]*Feed
+
+	// Texts lists every Text, newest first
+	Texts []*Text
+
+	// Tags maps each tag to the Texts tagged with it, newest first
+	Tags map[string][]*Text
+
+	// Series maps the name of each series to its parts, in order
+	Series map[string][]*Text
+
+	// Built is the time this build started
+	Built time.Time
+
+	// Config is the site configuration (title, description, base URL etc)
+	Config *SiteConfig
+
+	byId Texts
+
+	// translations maps each translation key to the Texts sharing it
+	translations map[string][]*Text
+}
+
+// NewSite collects F and T into a Site. Each Feed Index is sorted newest first.
+func NewSite(F Feeds, T Texts) *Site {
+	S := &Site{
+		Feeds:  make(map[string]*Feed, len(F)),
+		Texts:  make([]*Text, 0, len(T)),
+		Tags:   make(map[string][]*Text),
+		Series: make(map[string][]*Text),
+		Built:  time.Now().In(Timezone),
+		Config: &SiteConfig{},
+		byId:   T,
+	}
+	for _, f := range F {
+		f.SortByCreatedDescending()
+		S.Feeds[*f.Slug] = f
+	}
+	for _, t := range T {
+		S.Texts = append(S.Texts, t)
+	}
+	slices.SortFunc(S.Texts, func(a, b *Text) int { return b.Created.Compare(*a.Created) })
+	for _, t := range S.Texts {
+		for _, tag := range t.Tags {
+			S.Tags[tag] = append(S.Tags[tag], t)
+		}
+	}
+	for _, t := range S.Texts {
+		if t.Series != nil {
+			S.Series[t.Series.Name] = append(S.Series[t.Series.Name], t)
+		}
+	}
+	for _, parts := range S.Series {
+		sortSeriesParts(parts)
+	}
+	S.translations = make(map[string][]*Text)
+	for _, t := range S.Texts {
+		k := S.translationKey(t)
+		S.translations[k] = append(S.translations[k], t)
+	}
+	return S
+}
+
+// translationKey returns the TranslationKey of T, following a TranslationOf that names another
+// Text to that Text's key, so a Text translating a translation joins the same group.
+func (S *Site) translationKey(T *Text) string {
+	k := T.TranslationKey()
+	for seen := 0; seen < len(S.byId); seen++ {
+		other := S.byId.Get(k)
+		if other == nil || other == T || other.TranslationOf == nil || *other.TranslationOf == k {
+			break
+		}
+		k = *other.TranslationOf
+	}
+	return k
+}
+
+// Translations returns the other Texts in the translation group of T, ordered by language.
+func (S *Site) Translations(T *Text) []*Text {
+	var ts []*Text
+	for _, t := range S.translations[S.translationKey(T)] {
+		if t != T {
+			ts = append(ts, t)
+		}
+	}
+	slices.SortFunc(ts, func(a, b *Text) int { return cmp.Compare(a.Language(), b.Language()) })
+	return ts
+}
+
+// A TranslationLink is a translation of a Text and where it's published.
+type TranslationLink struct {
+	// Lang is the language of the translation, eg "de"
+	Lang string
+
+	// URL is the root-relative URL of the translation
+	URL string
+
+	Text *Text
+}
+
+// TranslationLinks returns a TranslationLink for each of the Translations of T that has a language
+// and is published in a Feed that isn't robots excluded (see PublicURLFor), ordered by language.
+// Translations that are unpublished, or only published in excluded Feeds, are left out so their
+// URLs aren't revealed.
+func (S *Site) TranslationLinks(T *Text) []TranslationLink {
+	var ls []TranslationLink
+	for _, t := range S.Translations(T) {
+		if u := S.PublicURLFor(t); u != "" && t.Language() != "" {
+			ls = append(ls, TranslationLink{Lang: t.Language(), URL: u, Text: t})
+		}
+	}
+	return ls
+}
+
+// Languages returns the language of every Text, sorted, without duplicates.
+func (S *Site) Languages() []string {
+	var ls []string
+	for _, t := range S.Texts {
+		if l := t.Language(); l != "" {
+			ls = append(ls, l)
+		}
+	}
+	slices.Sort(ls)
+	return slices.Compact(ls)
+}
+
+// Feed returns the Feed with the given slug, or nil.
+func (S *Site) Feed(slug string) *Feed {
+	return S.Feeds[slug]
+}
+
+// Text returns the Text with the given id, or nil.
+func (S *Site) Text(id string) *Text {
+	return S.byId.Get(id)
+}
+
+// SeriesNames returns the name of every series, sorted.
+func (S *Site) SeriesNames() []string {
+	names := make([]string, 0, len(S.Series))
+	for n := range S.Series {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TagNames returns every tag in use, sorted.
+func (S *Site) TagNames() []string {
+	tags := make([]string, 0, len(S.Tags))
+	for t := range S.Tags {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// Recent returns up to n of the newest Texts in the Feed with the given slug.
+func (S *Site) Recent(slug string, n int) []*Text {
+	f := S.Feeds[slug]
+	if f == nil {
+		return nil
+	}
+	return f.Index[:min(n, len(f.Index))]
+}
+
+// FeedsOf returns every Feed publishing T with a CanonicalPath, ordered by slug.
+func (S *Site) FeedsOf(T *Text) []*Feed {
+	var fs []*Feed
+	for _, f := range S.Feeds {
+		if len(f.CanonicalPath) > 0 && slices.Contains(f.Index, T) {
+			fs = append(fs, f)
+		}
+	}
+	slices.SortFunc(fs, func(a, b *Feed) int { return cmp.Compare(*a.Slug, *b.Slug) })
+	return fs
+}
+
+// URLFor returns the root-relative URL of T in the first Feed publishing it (by slug), preferring
+// Feeds that search engines may index, so the result doesn't depend on which Feed is being
+// published. An empty string is returned if T isn't published anywhere.
+func (S *Site) URLFor(T *Text) string {
+	if u := S.PublicURLFor(T); u != "" {
+		return u
+	}
+	if T == nil {
+		return ""
+	}
+	for _, f := range S.FeedsOf(T) {
+		if p := f.GetURL(T.Id.String()); p != "" {
+			return "/" + p
+		}
+	}
+	return ""
+}
+
+// PublicURLFor returns the root-relative URL of T in the first Feed publishing it (by slug) that
+// isn't robots excluded, or an empty string, so that links on public pages never reveal the URL of
+// a Text only published in an excluded Feed.
+func (S *Site) PublicURLFor(T *Text) string {
+	if T == nil {
+		return ""
+	}
+	for _, f := range S.FeedsOf(T) {
+		if f.IsRobotsExcluded() {
+			continue
+		}
+		if p := f.GetURL(T.Id.String()); p != "" {
+			return "/" + p
+		}
+	}
+	return ""
+}
+
+// URLForID returns the root-relative URL of the Text with the given id, as URLFor.
+func (S *Site) URLForID(id string) string {
+	return S.URLFor(S.Text(id))
+}
+
+// A SearchEntry describes one Text for client-side search.
+type SearchEntry struct {
+	Title       string
+	URL         string
+	Description string
+	Tags        []string `json:",omitempty"`
+}
+
+// SearchIndex returns a SearchEntry for each Text published by a Feed that search engines may
+// index, newest first. Texts only published in robots excluded Feeds are left out, so the index
+// never reveals their URLs.
+func (S *Site) SearchIndex() []SearchEntry {
+	idx := make([]SearchEntry, 0, len(S.Texts))
+	for _, T := range S.Texts {
+		for _, f := range S.FeedsOf(T) {
+			if f.IsRobotsExcluded() {
+				continue
+			}
+			e := SearchEntry{URL: "/" + f.GetURL(T.Id.String()), Description: T.Description(), Tags: T.Tags}
+			if T.Title != nil {
+				e.Title = *T.Title
+			}
+			idx = append(idx, e)
+			break
+		}
+	}
+	return idx
+}
@@ -0,0 +1,357 @@
+package enbypub
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	html "html/template"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// TemplateFuncs holds the functions available to every template the Generator executes, both for
+// Texts and for aggregators. It should be registered with Funcs before the templates are parsed.
+// Functions taking a value to operate on take it last, so they can be used in pipelines, eg
+// `{{ .Text.Title | truncate 40 | upper }}`.
+//
+//	metadata FEED TEXT
+//		Returns the canonical link, Open Graph, Twitter card, JSON-LD and robots elements
+//		for TEXT as published in FEED, eg `{{ metadata .Feed .Text }}` in a <head>.
+//
+// Dates and times:
+//
+//	now
+//		Returns the current time.
+//	date LAYOUT TIME
+//		Formats TIME (a time.Time, *time.Time or RFC 3339 string) with a Go time layout, or
+//		one of the names "rfc3339", "rfc1123", "rfc822" or "iso8601" (a date only). A nil
+//		*time.Time gives an empty string.
+//	localdate LANG LAYOUT TIME
+//		Formats TIME as date does, with the month and weekday names of LANG (a BCP 47 tag,
+//		or "" for the site language), eg `{{ localdate .Text.Language "2. January 2006" . }}`.
+//		Languages FormatLocalDate has no names for use English, with a warning logged.
+//
+// Languages:
+//
+//	languageName LANG
+//		Returns the name of LANG in that language, eg "Deutsch" for "de", or LANG itself if
+//		it isn't a known tag.
+//
+// Strings:
+//
+//	lower S, upper S, title S
+//		Changes the case of S.
+//	trim S, trimPrefix PREFIX S, trimSuffix SUFFIX S
+//		Removes whitespace, or PREFIX or SUFFIX, from S.
+//	replace OLD NEW S
+//		Replaces every OLD in S with NEW.
+//	split SEP S, join SEP LIST
+//		Splits S around SEP, or joins the strings in LIST with SEP.
+//	contains SUBSTR S, hasPrefix PREFIX S, hasSuffix SUFFIX S
+//		Tests S.
+//	slugify S
+//		Returns S as a slug, as used for Text slugs.
+//	truncate N S
+//		Shortens S to at most N runes at a word boundary, adding an ellipsis.
+//	plainify HTML
+//		Strips the tags from HTML and collapses its whitespace.
+//	markdownify S
+//		Renders S as Markdown.
+//	default DEFAULT V
+//		Returns V, or DEFAULT if V is empty (a zero value, nil, or an empty slice or map).
+//	json V
+//		Encodes V as JSON, eg for a <script> element.
+//
+// Lists (any slice, unless a list of Texts is required):
+//
+//	first N LIST, last N LIST, after N LIST
+//		Returns the first N, the last N, or all but the first N elements of LIST.
+//	reverse LIST
+//		Returns a reversed copy of LIST.
+//	where TEXTS FIELD VALUE
+//		Returns the Texts with FIELD equal to VALUE. FIELD is "tag", "title", "created",
+//		"modified" or any attribute, eg `{{ where .Index "param.category" "travel" }}`.
+//	filter TEXTS EXPR
+//		Returns the Texts matching EXPR, a match expression as used by Feeds.
+//	sortBy TEXTS FIELD [ORDER]
+//		Returns a copy of TEXTS sorted by FIELD (as for where) in ORDER, "asc" (the
+//		default) or "desc". Texts without FIELD sort last.
+//
+// The Generator adds the functions returned by Funcs, which depend on its Site.
+var TemplateFuncs = html.FuncMap{
+	"metadata": Metadata,
+
+	"now":       func() time.Time { return time.Now().In(Timezone) },
+	"date":      templateDate,
+	"localdate": templateLocalDate,
+
+	"languageName": templateLanguageName,
+
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+	"title":       cases.Title(language.Und, cases.NoLower).String,
+	"trim":        strings.TrimSpace,
+	"trimPrefix":  func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":  func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":     func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"split":       func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":        func(sep string, l []string) string { return strings.Join(l, sep) },
+	"contains":    func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":   func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":   func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"slugify":     func(s string) string { return *Sluggify(&s) },
+	"truncate":    func(n int, s string) string { return Truncate(s, n) },
+	"plainify":    func(s string) string { return PlainText(s) },
+	"markdownify": templateMarkdownify,
+	"default":     templateDefault,
+	"json":        templateJSON,
+
+	"first":   func(n int, l any) (any, error) { return templateSlice(l, 0, n) },
+	"last":    func(n int, l any) (any, error) { return templateSlice(l, -n, -1) },
+	"after":   func(n int, l any) (any, error) { return templateSlice(l, n, -1) },
+	"reverse": templateReverse,
+	"where":   templateWhere,
+	"filter":  templateFilter,
+	"sortBy":  templateSortBy,
+}
+
+// Funcs returns TemplateFuncs along with functions that look things up in the Site being
+// published by g:
+//
+//	site
+//		Returns the Site, eg `{{ range (site).TagNames }}`.
+//	urlFor TEXT
+//		Returns the root-relative URL of TEXT (see Site.URLFor), preferring Feeds that
+//		aren't robots excluded.
+//	urlForID ID
+//		Returns the root-relative URL of the Text with the uuid ID.
+//	absURL PATH
+//		Returns PATH (relative to the public root) as an absolute URL if a base URL is
+//		configured, or as a root-relative path otherwise.
+func (g *Generator) Funcs() html.FuncMap {
+	fm := maps.Clone(TemplateFuncs)
+	fm["site"] = func() *Site { return g.Site }
+	fm["urlFor"] = func(T *Text) string { return g.Site.URLFor(T) }
+	fm["urlForID"] = func(id string) string { return g.Site.URLForID(id) }
+	fm["absURL"] = g.AbsURL
+	return fm
+}
+
+var templateDateLayouts = map[string]string{
+	"rfc3339": time.RFC3339,
+	"rfc1123": time.RFC1123Z,
+	"rfc822":  time.RFC822Z,
+	"iso8601": time.DateOnly,
+}
+
+func templateDate(layout string, v any) (string, error) {
+	t, ok, err := templateTime("date", v)
+	if !ok {
+		return "", err
+	}
+	if l, ok := templateDateLayouts[strings.ToLower(layout)]; ok {
+		layout = l
+	}
+	return t.Format(layout), nil
+}
+
+func templateLocalDate(lang, layout string, v any) (string, error) {
+	t, ok, err := templateTime("localdate", v)
+	if !ok {
+		return "", err
+	}
+	if l, ok := templateDateLayouts[strings.ToLower(layout)]; ok {
+		layout = l
+	}
+	s, err := FormatLocalDate(t, layout, lang)
+	if err != nil {
+		// a page in a language without names still renders, in English
+		if _, warned := localDateWarnings.LoadOrStore(lang, true); !warned {
+			slog.Warn("localdate: "+err.Error()+"; using English names", "lang", lang)
+		}
+	}
+	return s, nil
+}
+
+// localDateWarnings holds the languages localdate has warned about, so each is reported once.
+var localDateWarnings sync.Map
+
+// templateTime returns v (a time.Time, *time.Time or RFC 3339 string) in Timezone for the template
+// function fn, or false if v is a nil *time.Time or can't be used.
+func templateTime(fn string, v any) (time.Time, bool, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(Timezone), true, nil
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, false, nil
+		}
+		return t.In(Timezone), true, nil
+	case string:
+		p, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%s: cannot parse %q: %w", fn, t, err)
+		}
+		return p.In(Timezone), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%s: cannot format a %T", fn, v)
+}
+
+func templateLanguageName(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return lang
+	}
+	if name := display.Self.Name(tag); name != "" {
+		return name
+	}
+	return lang
+}
+
+func templateMarkdownify(s string) (html.HTML, error) {
+	var B bytes.Buffer
+	if err := RenderMarkdown([]byte(s), &B); err != nil {
+		return "", fmt.Errorf("markdownify: %w", err)
+	}
+	return html.HTML(B.String()), nil
+}
+
+func templateDefault(def, v any) any {
+	r := reflect.ValueOf(v)
+	if !r.IsValid() {
+		return def
+	}
+	switch r.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if r.Len() == 0 {
+			return def
+		}
+	case reflect.Pointer, reflect.Interface:
+		if r.IsNil() {
+			return def
+		}
+	default:
+		if r.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+func templateJSON(v any) (html.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("json: %w", err)
+	}
+	// json.Marshal escapes <, > and &, so the result is safe inside a script element
+	return html.JS(b), nil
+}
+
+// templateSlice returns l[from:to] for any slice l. Negative bounds count from the end of the
+// slice, with -1 being the end itself; bounds beyond the slice are clamped.
+func templateSlice(l any, from, to int) (any, error) {
+	r := reflect.ValueOf(l)
+	if r.Kind() != reflect.Slice && r.Kind() != reflect.String {
+		return nil, fmt.Errorf("cannot slice a %T", l)
+	}
+	n := r.Len()
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n + 1
+	}
+	from = max(0, min(from, n))
+	to = max(from, min(to, n))
+	return r.Slice(from, to).Interface(), nil
+}
+
+func templateReverse(l any) (any, error) {
+	r := reflect.ValueOf(l)
+	if r.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("reverse: cannot reverse a %T", l)
+	}
+	out := reflect.MakeSlice(r.Type(), r.Len(), r.Len())
+	for i := range r.Len() {
+		out.Index(r.Len() - 1 - i).Set(r.Index(i))
+	}
+	return out.Interface(), nil
+}
+
+func templateWhere(texts []*Text, field string, value any) []*Text {
+	m := matchCompare{field: field, value: fmt.Sprint(value)}
+	return slices.DeleteFunc(slices.Clone(texts), func(T *Text) bool { return !m.eval(T) })
+}
+
+func templateFilter(texts []*Text, expr string) ([]*Text, error) {
+	m, err := parseMatch(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	return slices.DeleteFunc(slices.Clone(texts), func(T *Text) bool { return !m.eval(T) }), nil
+}
+
+func templateSortBy(texts []*Text, field string, order ...string) ([]*Text, error) {
+	desc := false
+	if len(order) > 0 {
+		switch strings.ToLower(order[0]) {
+		case "asc":
+		case "desc":
+			desc = true
+		default:
+			return nil, fmt.Errorf("sortBy: unknown order %q", order[0])
+		}
+	}
+	sorted := slices.Clone(texts)
+	slices.SortStableFunc(sorted, func(a, b *Text) int {
+		av, aok := a.field(field)
+		bv, bok := b.field(field)
+		if !aok || !bok {
+			// missing values always sort last, whatever the order
+			return compareBool(bok, aok)
+		}
+		c := compareFieldValues(av, bv)
+		if desc {
+			return -c
+		}
+		return c
+	})
+	return sorted, nil
+}
+
+// compareFieldValues compares two field values numerically if both are numbers, as times if both
+// are RFC 3339 times, or as strings.
+func compareFieldValues(a, b string) int {
+	if af, err := strconv.ParseFloat(a, 64); err == nil {
+		if bf, err := strconv.ParseFloat(b, 64); err == nil {
+			return cmp.Compare(af, bf)
+		}
+	}
+	if at, err := time.Parse(time.RFC3339, a); err == nil {
+		if bt, err := time.Parse(time.RFC3339, b); err == nil {
+			return at.Compare(bt)
+		}
+	}
+	return cmp.Compare(a, b)
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
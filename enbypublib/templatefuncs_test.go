@@ -0,0 +1,303 @@
+package enbypub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateDate(t *testing.T) {
+	tm := time.Date(2024, time.March, 5, 22, 30, 0, 0, time.UTC)
+	var nilTime *time.Time
+	tests := []struct {
+		layout string
+		v      any
+		want   string
+		err    bool
+	}{
+		{"2006-01-02 15:04", tm, "2024-03-05 22:30", false},
+		{"2006-01-02 15:04", &tm, "2024-03-05 22:30", false},
+		{"rfc3339", tm, "2024-03-05T22:30:00Z", false},
+		{"RFC3339", tm, "2024-03-05T22:30:00Z", false},
+		{"rfc1123", tm, "Tue, 05 Mar 2024 22:30:00 +0000", false},
+		{"rfc822", tm, "05 Mar 24 22:30 +0000", false},
+		{"iso8601", tm, "2024-03-05", false},
+		{"iso8601", nilTime, "", false},
+		{"iso8601", "2024-03-05T22:30:00Z", "2024-03-05", false},
+		{"iso8601", "2024-03-05T23:30:00+02:00", "2024-03-05", false},
+		{"iso8601", "2024-03-05", "", true},
+		{"iso8601", 42, "", true},
+	}
+	for _, tt := range tests {
+		got, err := templateDate(tt.layout, tt.v)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("date %q %#v = %q, %v; want %q (error %v)", tt.layout, tt.v, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTemplateDateTimezone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	defer func(tz *time.Location) { Timezone = tz }(Timezone)
+	Timezone = ny
+
+	tm := time.Date(2024, time.March, 6, 2, 30, 0, 0, time.UTC)
+	tests := []struct {
+		layout string
+		v      any
+		want   string
+	}{
+		{"iso8601", tm, "2024-03-05"},
+		{"iso8601", &tm, "2024-03-05"},
+		{"iso8601", "2024-03-06T02:30:00Z", "2024-03-05"},
+		{"rfc3339", tm, "2024-03-05T21:30:00-05:00"},
+		{"15:04 MST", tm, "21:30 EST"},
+	}
+	for _, tt := range tests {
+		got, err := templateDate(tt.layout, tt.v)
+		if err != nil || got != tt.want {
+			t.Errorf("date %q %#v = %q, %v; want %q", tt.layout, tt.v, got, err, tt.want)
+		}
+	}
+
+	got, err := templateLocalDate("de", "Monday, 2. January 2006", tm)
+	if want := "Dienstag, 5. März 2024"; err != nil || got != want {
+		t.Errorf("localdate in %v = %q, %v; want %q", ny, got, err, want)
+	}
+}
+
+func TestTemplateLocalDate(t *testing.T) {
+	tm := time.Date(2024, time.March, 5, 22, 30, 0, 0, time.UTC)
+	var nilTime *time.Time
+	tests := []struct {
+		lang, layout string
+		v            any
+		want         string
+		err          bool
+	}{
+		{"de", "Monday, 2. January 2006", tm, "Dienstag, 5. März 2024", false},
+		{"fr", "Mon 2 Jan 2006", tm, "mar. 5 mars 2024", false},
+		{"de-AT", "January", tm, "März", false},
+		{"en", "Monday, January 2", tm, "Tuesday, March 5", false},
+		{"ja", "January", tm, "March", false},
+		{"not a tag!", "January", tm, "March", false},
+		{"de", "iso8601", tm, "2024-03-05", false},
+		{"de", "rfc1123", tm, "Di., 05 März 2024 22:30:00 +0000", false},
+		{"de", "January", nilTime, "", false},
+		{"de", "January", "2024-03-05T22:30:00Z", "März", false},
+		{"de", "January", "yesterday", "", true},
+	}
+	for _, tt := range tests {
+		got, err := templateLocalDate(tt.lang, tt.layout, tt.v)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("localdate %q %q %#v = %q, %v; want %q (error %v)", tt.lang, tt.layout, tt.v, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTemplateTruncate(t *testing.T) {
+	truncate := TemplateFuncs["truncate"].(func(int, string) string)
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{20, "short", "short"},
+		{5, "exact", "exact"},
+		{12, "hello there, world", "hello…"},
+		{13, "hello there, world", "hello there…"},
+		{4, "overlong", "over…"},
+		{6, "naïve café", "naïve…"},
+		{0, "", ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.s); got != tt.want {
+			t.Errorf("truncate %d %q = %q; want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateSlices(t *testing.T) {
+	l := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		fn   string
+		n    int
+		l    any
+		want any
+	}{
+		{"first", 2, l, []string{"a", "b"}},
+		{"first", 0, l, []string{}},
+		{"first", 10, l, l},
+		{"last", 1, l, []string{"d"}},
+		{"last", 3, l, []string{"b", "c", "d"}},
+		{"last", 10, l, l},
+		{"after", 1, l, []string{"b", "c", "d"}},
+		{"after", 0, l, l},
+		{"after", 10, l, []string{}},
+		{"first", 2, []int{1, 2, 3}, []int{1, 2}},
+		{"first", 3, "abcdef", "abc"},
+		{"last", 2, []string(nil), []string(nil)},
+	}
+	for _, tt := range tests {
+		fn := TemplateFuncs[tt.fn].(func(int, any) (any, error))
+		got, err := fn(tt.n, tt.l)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %d %#v = %#v, %v; want %#v", tt.fn, tt.n, tt.l, got, err, tt.want)
+		}
+	}
+
+	for _, name := range []string{"first", "last", "after"} {
+		fn := TemplateFuncs[name].(func(int, any) (any, error))
+		if _, err := fn(1, 42); err == nil {
+			t.Errorf("%s 1 42 returned no error", name)
+		}
+	}
+}
+
+// testTexts returns Texts to run list functions over: Alpha, Bravo and Charlie, in that order.
+func testTexts() []*Text {
+	created := func(day int) *time.Time {
+		t := time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	return []*Text{
+		{
+			Title:   strptr("Alpha"),
+			Slug:    strptr("alpha"),
+			Created: created(3),
+			Tags:    []string{"public", "travel"},
+			Params:  map[string]any{"category": "travel", "rating": 10},
+		},
+		{
+			Title:   strptr("Bravo"),
+			Slug:    strptr("bravo"),
+			Created: created(1),
+			Tags:    []string{"public"},
+			Params:  map[string]any{"category": "food", "rating": 9},
+		},
+		{
+			Title:   strptr("Charlie"),
+			Slug:    strptr("charlie"),
+			Created: created(2),
+			Tags:    []string{"travel"},
+		},
+	}
+}
+
+func titles(texts []*Text) []string {
+	var s []string
+	for _, T := range texts {
+		s = append(s, *T.Title)
+	}
+	return s
+}
+
+func TestTemplateWhere(t *testing.T) {
+	texts := testTexts()
+	tests := []struct {
+		field string
+		value any
+		want  []string
+	}{
+		{"tag", "travel", []string{"Alpha", "Charlie"}},
+		{"tag", "draft", nil},
+		{"title", "Bravo", []string{"Bravo"}},
+		{"slug", "charlie", []string{"Charlie"}},
+		{"param.category", "travel", []string{"Alpha"}},
+		{"param.rating", 9, []string{"Bravo"}},
+		{"param.missing", "", nil},
+		{"created", "2024-03-02T12:00:00Z", []string{"Charlie"}},
+	}
+	for _, tt := range tests {
+		got := templateWhere(texts, tt.field, tt.value)
+		if !reflect.DeepEqual(titles(got), tt.want) {
+			t.Errorf("where %q %#v = %q; want %q", tt.field, tt.value, titles(got), tt.want)
+		}
+	}
+	if !reflect.DeepEqual(titles(texts), []string{"Alpha", "Bravo", "Charlie"}) {
+		t.Errorf("where changed its list to %q", titles(texts))
+	}
+}
+
+func TestTemplateSortBy(t *testing.T) {
+	texts := testTexts()
+	tests := []struct {
+		field string
+		order []string
+		want  []string
+		err   bool
+	}{
+		{"created", nil, []string{"Bravo", "Charlie", "Alpha"}, false},
+		{"created", []string{"desc"}, []string{"Alpha", "Charlie", "Bravo"}, false},
+		{"title", []string{"DESC"}, []string{"Charlie", "Bravo", "Alpha"}, false},
+		{"title", []string{"asc"}, []string{"Alpha", "Bravo", "Charlie"}, false},
+		// numbers compare numerically, and Texts without the field sort last either way
+		{"param.rating", nil, []string{"Bravo", "Alpha", "Charlie"}, false},
+		{"param.rating", []string{"desc"}, []string{"Alpha", "Bravo", "Charlie"}, false},
+		{"param.category", nil, []string{"Bravo", "Alpha", "Charlie"}, false},
+		{"title", []string{"sideways"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := templateSortBy(texts, tt.field, tt.order...)
+		if (err != nil) != tt.err || !reflect.DeepEqual(titles(got), tt.want) {
+			t.Errorf("sortBy %q %q = %q, %v; want %q (error %v)", tt.field, tt.order, titles(got), err, tt.want, tt.err)
+		}
+	}
+	if !reflect.DeepEqual(titles(texts), []string{"Alpha", "Bravo", "Charlie"}) {
+		t.Errorf("sortBy changed its list to %q", titles(texts))
+	}
+}
+
+func TestTemplateDefault(t *testing.T) {
+	var nilTime *time.Time
+	var nilAny any
+	tm := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    any
+		want any
+	}{
+		{nil, "def"},
+		{nilAny, "def"},
+		{"", "def"},
+		{"set", "set"},
+		{0, "def"},
+		{3, 3},
+		{false, "def"},
+		{true, true},
+		{[]string{}, "def"},
+		{[]string{"a"}, []string{"a"}},
+		{map[string]any{}, "def"},
+		{nilTime, "def"},
+		{&tm, &tm},
+		{time.Time{}, "def"},
+		{tm, tm},
+	}
+	for _, tt := range tests {
+		if got := templateDefault("def", tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("default %q %#v = %#v; want %#v", "def", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateMarkdownify(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"plain", "<p>plain</p>"},
+		{"*emphasis* and **strong**", "<p><em>emphasis</em> and <strong>strong</strong></p>"},
+		{"[a link](https://example.com/)", `<p><a href="https://example.com/">a link</a></p>`},
+		{"a < b & c", "<p>a &lt; b &amp; c</p>"},
+	}
+	for _, tt := range tests {
+		got, err := templateMarkdownify(tt.s)
+		if err != nil || strings.TrimSpace(string(got)) != tt.want {
+			t.Errorf("markdownify %q = %q, %v; want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package enbypub
+
+import (
+	"errors"
+	"fmt"
+	html "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	text "text/template"
+	"text/template/parse"
+)
+
+// TemplateLayout is the name of the layout a page template is rendered through when it consists
+// only of {{ define }} blocks. The layout provides the page skeleton, using {{ block }} for the
+// parts a page may override, eg `{{ block "main" . }}{{ end }}`. A Feed may have its own layout
+// at `<feedslug>/layouts/base.html`.
+var TemplateLayout = "layouts/base.html"
+
+// TemplateSharedDirs are the directory names whose templates are shared with every page template,
+// wherever they occur in the templates directory.
+var TemplateSharedDirs = []string{"partials", "layouts"}
+
+// TextTemplateSuffix marks the files in a templates directory that are parsed with text/template
+// rather than html/template, for outputs that mustn't be HTML escaped (eg "humans.txt.tmpl").
+var TextTemplateSuffix = ".tmpl"
+
+// A TemplateSet holds the templates loaded from a templates directory. Each template is named by
+// its slash separated path relative to that directory, eg "page.html", "partials/nav.html" or
+// "blog/page.html". Every HTML page template is parsed into its own copy of the shared templates
+// (partials and layouts), so pages may define the same blocks without colliding. Text templates
+// are parsed into a single set of their own.
+type TemplateSet struct {
+	shared *html.Template
+	pages  map[string]*html.Template
+	text   *text.Template
+
+	// themed holds the names of the templates loaded from DefaultTheme
+	themed map[string]bool
+}
+
+// LoadTemplates parses every .html and TextTemplateSuffix file below dir in fsys, with funcs
+// available to each. Any
+// template in DefaultTheme that isn't in dir is loaded from there instead; dir need not exist.
+func LoadTemplates(fsys fs.FS, dir string, funcs html.FuncMap) (*TemplateSet, error) {
+	type source struct {
+		fsys  fs.FS
+		fn    string
+		theme bool
+	}
+	sources := make(map[string]source)
+	walk := func(fsys fs.FS, dir string, theme bool) error {
+		return fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == dir && errors.Is(err, fs.ErrNotExist) {
+					return fs.SkipAll
+				}
+				return err
+			}
+			if d.IsDir() || (path.Ext(p) != ".html" && !strings.HasSuffix(p, TextTemplateSuffix)) {
+				return nil
+			}
+			name := strings.TrimPrefix(p, dir+"/")
+			if _, ok := sources[name]; !ok {
+				sources[name] = source{fsys, p, theme}
+			}
+			return nil
+		})
+	}
+	if err := walk(fsys, dir, false); err != nil {
+		return nil, fmt.Errorf("cannot walk templates directory %q: %w", dir, err)
+	}
+	if err := walk(DefaultTheme, ".", true); err != nil {
+		return nil, fmt.Errorf("cannot walk default theme: %w", err)
+	}
+	var shared, pages, texts []string
+	themed := make(map[string]bool)
+	for name, s := range sources {
+		if s.theme {
+			themed[name] = true
+		}
+		if strings.HasSuffix(name, TextTemplateSuffix) {
+			texts = append(texts, name)
+		} else if isSharedTemplate(name) {
+			shared = append(shared, name)
+		} else {
+			pages = append(pages, name)
+		}
+	}
+	slices.Sort(shared)
+
+	ts := &TemplateSet{
+		shared: html.New("").Funcs(funcs),
+		pages:  make(map[string]*html.Template),
+		text:   text.New("").Funcs(text.FuncMap(funcs)),
+		themed: themed,
+	}
+	for _, name := range shared {
+		s := sources[name]
+		if err := parseTemplateFile(ts.shared.New(name), s.fsys, s.fn); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range pages {
+		c, err := ts.shared.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("cannot copy shared templates for %q: %w", name, err)
+		}
+		s := sources[name]
+		if err := parseTemplateFile(c.New(name), s.fsys, s.fn); err != nil {
+			return nil, err
+		}
+		ts.pages[name] = c
+	}
+	for _, name := range texts {
+		s := sources[name]
+		b, err := fs.ReadFile(s.fsys, s.fn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template %q: %w", s.fn, err)
+		}
+		if _, err := ts.text.New(name).Parse(string(b)); err != nil {
+			return nil, sourceError(ErrorKindConfig, s.fn, b, 0, fmt.Errorf("cannot parse template: %w", err))
+		}
+	}
+	return ts, nil
+}
+
+func isSharedTemplate(name string) bool {
+	for _, seg := range strings.Split(path.Dir(name), "/") {
+		if slices.Contains(TemplateSharedDirs, seg) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTemplateFile(t *html.Template, fsys fs.FS, fn string) error {
+	b, err := fs.ReadFile(fsys, fn)
+	if err != nil {
+		return fmt.Errorf("cannot read template %q: %w", fn, err)
+	}
+	if _, err := t.Parse(string(b)); err != nil {
+		return sourceError(ErrorKindConfig, fn, b, 0, fmt.Errorf("cannot parse template: %w", err))
+	}
+	return nil
+}
+
+// Names returns the name of every page and text template, sorted.
+func (ts *TemplateSet) Names() []string {
+	names := make([]string, 0, len(ts.pages))
+	for n := range ts.pages {
+		names = append(names, n)
+	}
+	for _, t := range ts.text.Templates() {
+		if t.Name() != "" {
+			names = append(names, t.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// IsThemed returns true if the template name was loaded from DefaultTheme rather than the
+// templates directory.
+func (ts *TemplateSet) IsThemed(name string) bool {
+	return ts.themed[name]
+}
+
+// IsTextTemplate returns true if name is the name of a text template.
+func IsTextTemplate(name string) bool {
+	return strings.HasSuffix(name, TextTemplateSuffix)
+}
+
+// templateCandidates returns the names a template may be found under for the Feed with the given
+// slug, most specific first.
+func templateCandidates(feed, name string) []string {
+	if feed == "" {
+		return []string{name}
+	}
+	return []string{feed + "/" + name, name}
+}
+
+// Resolve returns the name of the page template used for name in the Feed with the given slug (or
+// any Feed, if feed is empty): `<feed>/<name>` if it exists, otherwise name.
+func (ts *TemplateSet) Resolve(feed, name string) (string, bool) {
+	for _, c := range templateCandidates(feed, name) {
+		if IsTextTemplate(c) && ts.text.Lookup(c) != nil {
+			return c, true
+		}
+		if ts.pages[c] != nil {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// Execute renders the template name, as resolved for the Feed with the given slug, to w. An HTML
+// page template that only defines blocks is rendered through the Feed layout or TemplateLayout.
+func (ts *TemplateSet) Execute(w io.Writer, feed, name string, data any) error {
+	resolved, ok := ts.Resolve(feed, name)
+	if !ok {
+		return fmt.Errorf("template %q does not exist (looked for %s)", name, strings.Join(quoteAll(templateCandidates(feed, name)), ", "))
+	}
+	if IsTextTemplate(resolved) {
+		return ts.text.ExecuteTemplate(w, resolved, data)
+	}
+	t := ts.pages[resolved]
+	if !isBlankTemplate(t.Lookup(resolved)) {
+		return t.ExecuteTemplate(w, resolved, data)
+	}
+	for _, l := range templateCandidates(feed, TemplateLayout) {
+		if t.Lookup(l) != nil {
+			return t.ExecuteTemplate(w, l, data)
+		}
+	}
+	return fmt.Errorf("template %q only defines blocks, but there is no layout %q to render them with", resolved, TemplateLayout)
+}
+
+// isBlankTemplate returns true if t produces nothing but whitespace of its own, ie it only
+// defines other templates.
+func isBlankTemplate(t *html.Template) bool {
+	if t == nil || t.Tree == nil || t.Tree.Root == nil {
+		return true
+	}
+	for _, n := range t.Tree.Root.Nodes {
+		tn, ok := n.(*parse.TextNode)
+		if !ok || strings.TrimSpace(string(tn.Text)) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteAll(s []string) []string {
+	q := make([]string, len(s))
+	for i := range s {
+		q[i] = fmt.Sprintf("%q", s[i])
+	}
+	return q
+}
@@ -7,16 +7,16 @@ import (
 	"fmt"
 	"hash"
 	"html/template"
-	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	md "github.com/yuin/goldmark"
-	"gopkg.in/yaml.v2"
+	"golang.org/x/text/language"
 )
 
 // TextUnlikelyCreationDate represents an arbitrary threshold where filesystem times before this
@@ -28,6 +28,15 @@ var TextUnlikelyCreationDate = must1(time.Parse(time.RFC3339, "1993-08-31T23:59:
 // set to the traditional three (or more) dashes typically used for Markdown front matter.
 var TextMetadataDelimiter = regexp.MustCompile(`(?m:^---+[\r\n]+)`)
 
+// Timezone is the location that dates are shown in and that date attributes of Texts (year, month,
+// day etc) are taken in, whatever location their times were read with. Set it from the site
+// configuration so a Text lands in the same date directories wherever the site is built.
+var Timezone = time.UTC
+
+// DefaultLanguage is the BCP 47 tag of the language of Texts that don't set Lang, eg "en". Set it
+// from the site configuration.
+var DefaultLanguage string
+
 type Text struct {
 	// originalFilename is the original filename this Text was read from
 	originalFilename string
@@ -35,6 +44,10 @@ type Text struct {
 	// raw is the unparsed Body of the Text
 	raw []byte
 
+	// frontMatter is the metadata section of the Text as originally read, so that it can be
+	// rewritten without disturbing comments or formatting
+	frontMatter frontMatter
+
 	// Title specifies the title of the Text
 	Title *string `yaml:",omitempty"`
 
@@ -56,11 +69,29 @@ type Text struct {
 	// Tags specifies the distrubition of this Text
 	Tags []string `yaml:",omitempty"`
 
+	// Lang is the BCP 47 tag of the language this Text is written in, eg "de" or "pt-BR". If it
+	// isn't set, the Text is in DefaultLanguage.
+	Lang *string `yaml:",omitempty"`
+
+	// TranslationOf links this Text to its translations: either the id of the Text it translates,
+	// or any key shared by every Text in the group, eg "launch-announcement"
+	TranslationOf *string `yaml:",omitempty"`
+
+	// Series names the multi-part series this Text is a part of, if any
+	Series *Series `yaml:",omitempty"`
+
 	// Body is the parsed Markdown Document of the Text
 	// Body *mda.Document `yaml:"-"`
 
 	// Checksum determines whether the body of the Text has been changed since last processed
 	Checksum *string `yaml:",omitempty"`
+
+	// Resources lists the files stored alongside this Text if it is the index of a page bundle
+	Resources []*Resource `yaml:"-"`
+
+	// Params holds every other front matter field (eg author, hero image, category) so that it
+	// survives being rewritten and can be referenced from templates and canonical paths
+	Params map[string]any `yaml:",inline"`
 }
 
 func (T *Text) String() string {
@@ -98,28 +129,159 @@ func (T *Text) Get(a Attribute) (string, error) {
 		}
 	case TextAttributeYear:
 		if T.Created != nil {
-			return (*T.Created).Format("2006"), nil
+			return T.Created.In(Timezone).Format("2006"), nil
 		}
 	case TextAttributeMonth:
 		if T.Created != nil {
-			return (*T.Created).Format("01"), nil
+			return T.Created.In(Timezone).Format("01"), nil
 		}
 	case TextAttributeDay:
 		if T.Created != nil {
-			return (*T.Created).Format("02"), nil
+			return T.Created.In(Timezone).Format("02"), nil
 		}
 	case TextAttributeDayOfWeek:
 		if T.Created != nil {
-			return (*T.Created).Format("Mon"), nil
+			return T.Created.In(Timezone).Format("Mon"), nil
 		}
 	case TextAttributeYMD:
 		if T.Created != nil {
-			return (*T.Created).Format("20060102"), nil
+			return T.Created.In(Timezone).Format("20060102"), nil
+		}
+	case TextAttributeMonthName:
+		if T.Created != nil {
+			return strings.ToLower(T.Created.In(Timezone).Month().String()), nil
+		}
+	case TextAttributeISOWeek:
+		if T.Created != nil {
+			y, w := T.Created.In(Timezone).ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", y, w), nil
+		}
+	case TextAttributeQuarter:
+		if T.Created != nil {
+			return fmt.Sprintf("q%d", (T.Created.In(Timezone).Month()-1)/3+1), nil
+		}
+	case TextAttributeCreated:
+		if T.Created != nil {
+			return T.Created.In(Timezone).Format(time.DateOnly), nil
+		}
+	case TextAttributeModified:
+		if T.Modified != nil {
+			return T.Modified.In(Timezone).Format(time.DateOnly), nil
+		}
+	case TextAttributeModifiedYear:
+		if T.Modified != nil {
+			return T.Modified.In(Timezone).Format("2006"), nil
+		}
+	case TextAttributeModifiedMonth:
+		if T.Modified != nil {
+			return T.Modified.In(Timezone).Format("01"), nil
+		}
+	case TextAttributeModifiedDay:
+		if T.Modified != nil {
+			return T.Modified.In(Timezone).Format("02"), nil
+		}
+	case TextAttributeModifiedYMD:
+		if T.Modified != nil {
+			return T.Modified.In(Timezone).Format("20060102"), nil
+		}
+	case TextAttributeFirstTag:
+		if len(T.Tags) > 0 {
+			return *Sluggify(&T.Tags[0]), nil
+		}
+	case TextAttributeShortId:
+		if T.Id != nil {
+			return T.Id.String()[:8], nil
+		}
+	case TextAttributeTitleSlug:
+		if T.Title != nil {
+			return *Sluggify(T.Title), nil
+		}
+	case TextAttributeLang:
+		if l := T.Language(); l != "" {
+			return l, nil
+		}
+	default:
+		if name, ok := strings.CutPrefix(string(a), TextAttributeParamPrefix); ok {
+			if v, ok := T.Param(name); ok {
+				return v, nil
+			}
 		}
 	}
 	return "", fmt.Errorf("text does not have an attribute %q", string(a))
 }
 
+// Time returns the time Attribute a of T: TextAttributeCreated, TextAttributeModified, or a front
+// matter field holding a time (with TextAttributeParamPrefix).
+func (T *Text) Time(a Attribute) (time.Time, error) {
+	var t *time.Time
+	switch a {
+	case TextAttributeCreated:
+		t = T.Created
+	case TextAttributeModified:
+		t = T.Modified
+	default:
+		name, ok := strings.CutPrefix(string(a), TextAttributeParamPrefix)
+		if !ok {
+			break
+		}
+		switch v := T.Params[name].(type) {
+		case time.Time:
+			t = &v
+		case string:
+			p, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				if p, err = time.ParseInLocation(time.DateOnly, v, Timezone); err != nil {
+					return time.Time{}, fmt.Errorf("text attribute %q is not a time or date: %q", name, v)
+				}
+			}
+			t = &p
+		}
+	}
+	if t == nil {
+		return time.Time{}, fmt.Errorf("text does not have a time attribute %q", string(a))
+	}
+	return *t, nil
+}
+
+// Language returns Lang, or DefaultLanguage if it isn't set.
+func (T *Text) Language() string {
+	if T.Lang != nil {
+		return *T.Lang
+	}
+	return DefaultLanguage
+}
+
+// TranslationKey returns the key T shares with its translations: TranslationOf, or the id of T if
+// it isn't set, so that a Text is found by the translations naming it. A TranslationOf naming a
+// Text is resolved to that Text's own key by Site.
+func (T *Text) TranslationKey() string {
+	if T.TranslationOf != nil {
+		return *T.TranslationOf
+	}
+	if T.Id != nil {
+		return T.Id.String()
+	}
+	return ""
+}
+
+// Param returns the named front matter field from Params formatted as a string. Only scalar
+// values (strings, numbers, booleans and times) can be returned.
+func (T *Text) Param(name string) (string, bool) {
+	v, ok := T.Params[name]
+	if !ok || v == nil {
+		return "", false
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(v), true
+	case time.Time:
+		return v.In(Timezone).Format(time.RFC3339), true
+	}
+	return "", false
+}
+
 type Texts map[uuid.UUID]*Text
 
 func (t Texts) Get(id string) *Text {
@@ -129,39 +291,50 @@ func (t Texts) Get(id string) *Text {
 	return nil
 }
 
+// ReadOnly stops LoadTextFromFile and ReadFeedsFromFile writing the metadata they assign back to
+// the files they read, eg when validating a site. The metadata is still assigned in memory.
+var ReadOnly bool
+
 func LoadTextFromFile(fn string) (*Text, error) {
 	fstat, err := os.Stat(fn)
 	if err != nil {
-		return nil, fmt.Errorf("cannot stat file %q: %w", fn, err)
+		return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("cannot stat file: %w", err)}
 	}
 
 	mt := fstat.ModTime()
 	if mt.Before(TextUnlikelyCreationDate) {
-		fmt.Fprintf(os.Stderr, "warning: %q has unlikely file modification time %s\n", fn, mt.String())
+		slog.Warn("unlikely file modification time", "file", fn, "mtime", mt.String())
 		mt = time.Now()
 	}
 
 	T := Text{originalFilename: fn}
 	fbuf, err := os.ReadFile(fn)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read contents of file %q: %w", fn, err)
+		return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("cannot read contents of file: %w", err)}
 	}
 
-	delimpos := TextMetadataDelimiter.FindAllIndex(fbuf, 2)
-	if len(delimpos) == 2 {
-		err = yaml.Unmarshal(fbuf[delimpos[0][1]:delimpos[1][1]], &T)
-		if err != nil {
-			return nil, fmt.Errorf("cannot read metadata from %q: %w", fn, err)
+	T.frontMatter, T.raw = splitFrontMatter(fbuf)
+	if err := T.frontMatter.decode(&T); err != nil {
+		return nil, sourceError(ErrorKindContent, fn, T.frontMatter.body, bytes.Count(T.frontMatter.open, []byte("\n")),
+			fmt.Errorf("cannot read metadata: %w", err))
+	}
+
+	if T.Lang != nil {
+		if _, err := language.Parse(*T.Lang); err != nil {
+			return nil, &SourceError{Kind: ErrorKindContent, File: fn, Err: fmt.Errorf("cannot read metadata: lang %q: %w", *T.Lang, err)}
 		}
-		T.raw = fbuf[delimpos[1][1]:]
-	} else {
-		T.raw = fbuf
 	}
 
 	if T.Created == nil {
 		T.Created = &mt
 	}
 
+	if IsBundleIndex(fn) {
+		if err := T.loadResources(); err != nil {
+			return nil, fmt.Errorf("cannot load page bundle resources for %q: %w", fn, err)
+		}
+	}
+
 	// T.Body = mda.NewDocument()
 	// T.Body.AppendChild(T.Body, md.DefaultParser().Parse(mdt.NewReader(T.raw)))
 
@@ -179,12 +352,16 @@ func LoadTextFromFile(fn string) (*Text, error) {
 			return nil, fmt.Errorf("cannot process %q: %w", fn, err)
 		}
 
+		if ReadOnly {
+			return &T, nil
+		}
+
 		if err := T.PutFile(); err != nil {
-			return nil, fmt.Errorf("cannot update %q: %w", fn, err)
+			return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("cannot update: %w", err)}
 		}
 
 		if err := T.SetFSModificationTime(); err != nil {
-			return nil, fmt.Errorf("cannot update %q mtime: %w", fn, err)
+			return nil, &SourceError{Kind: ErrorKindIO, File: fn, Err: fmt.Errorf("cannot update mtime: %w", err)}
 		}
 	}
 
@@ -227,7 +404,13 @@ func (T *Text) Process() error {
 		T.Id = &u
 	}
 	if T.Title == nil {
-		T.Title = Titlenate(&T.originalFilename)
+		if IsBundleIndex(T.originalFilename) {
+			// a page bundle is named by its directory rather than its index file
+			dir := filepath.Dir(T.originalFilename)
+			T.Title = Titlenate(&dir)
+		} else {
+			T.Title = Titlenate(&T.originalFilename)
+		}
 	}
 	if T.Slug == nil {
 		T.Slug = Sluggify(T.Title)
@@ -235,28 +418,43 @@ func (T *Text) Process() error {
 	return nil
 }
 
+// PutFile rewrites the file this Text was read from with its current metadata. Only the fields
+// enbypub manages are updated in the front matter; everything else is preserved as written.
 func (T *Text) PutFile() error {
-	//TODO: replace all of this with os.WriteFile
-
-	fp, err := os.OpenFile(T.originalFilename, os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
-		return fmt.Errorf("unable to re-open %q to write: %w", T.originalFilename, err)
+	fields := []metadataField{}
+	if T.Title != nil {
+		fields = append(fields, metadataField{"title", T.Title})
 	}
-	defer fp.Close()
-
-	if _, err := io.WriteString(fp, "---\n"); err != nil {
-		return fmt.Errorf("cannot write first metadata delimiter: %w", err)
+	if T.Slug != nil {
+		fields = append(fields, metadataField{"slug", T.Slug})
 	}
-	if err := yaml.NewEncoder(fp).Encode(T); err != nil {
-		return fmt.Errorf("cannot re-write metadata: %w", err)
+	if T.Created != nil {
+		fields = append(fields, metadataField{"created", T.Created})
+	}
+	if T.Modified != nil {
+		fields = append(fields, metadataField{"modified", T.Modified})
 	}
-	if _, err := io.WriteString(fp, "---\n"); err != nil {
-		return fmt.Errorf("cannot write second metadata delimiter: %w", err)
+	if T.Id != nil {
+		fields = append(fields, metadataField{"id", T.Id})
 	}
-	if _, err := fp.Write(T.raw); err != nil {
-		return fmt.Errorf("cannot re-write body: %w", err)
+	if T.Checksum != nil {
+		fields = append(fields, metadataField{"checksum", T.Checksum})
 	}
 
+	fm, err := T.frontMatter.patch(fields)
+	if err != nil {
+		return fmt.Errorf("cannot re-write metadata: %w", err)
+	}
+	T.frontMatter = fm
+
+	var B bytes.Buffer
+	B.Write(fm.open)
+	B.Write(fm.body)
+	B.Write(fm.close)
+	B.Write(T.raw)
+	if err := os.WriteFile(T.originalFilename, B.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("unable to write %q: %w", T.originalFilename, err)
+	}
 	return nil
 }
 
@@ -277,14 +475,30 @@ func (T *Text) IsModified() bool {
 	return T.Modified.Sub(*T.Created) > time.Minute*5
 }
 
-// HTML returns an HTML fragment for the document body
-func (T *Text) HTML() template.HTML {
+// SourceFile returns the path of the file T was read from.
+func (T *Text) SourceFile() string {
+	return T.originalFilename
+}
+
+// HTML returns an HTML fragment for the document body, as HTMLIn does for no Feed: references
+// to Resources are left relative to the Text.
+func (T *Text) HTML() (template.HTML, error) {
+	return T.HTMLIn(nil)
+}
+
+// HTMLIn returns an HTML fragment for the document body as published in F, rendered according to
+// the extension of the file it was read from. Texts without a registered Renderer are treated as
+// Markdown.
+func (T *Text) HTMLIn(F *Feed) (template.HTML, error) {
+	r := RendererFor(T.originalFilename)
+	if r == nil {
+		r = RendererFunc(RenderMarkdown)
+	}
 	var B bytes.Buffer
-	err := md.Convert(T.raw, &B)
-	if err != nil {
-		panic(err)
+	if err := r.Render(T.raw, &B); err != nil {
+		return "", fmt.Errorf("cannot render %s: %w", T.originalFilename, err)
 	}
-	return template.HTML(B.String())
+	return template.HTML(T.rewriteResources(F, T.rewriteImages(F, B.String()))), nil
 }
 
 func (T Text) IsTagged(tag ...string) bool {
@@ -295,3 +509,13 @@ func (T Text) IsTagged(tag ...string) bool {
 	}
 	return false
 }
+
+// IsDraft reports whether T is a draft: tagged "draft", or with a true draft field in its front
+// matter.
+func (T *Text) IsDraft() bool {
+	if T.IsTagged("draft") {
+		return true
+	}
+	d, _ := T.Param("draft")
+	return d == "true"
+}
@@ -0,0 +1,83 @@
+package enbypub
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+//go:embed theme
+var theme embed.FS
+
+// DefaultTheme holds the templates used whenever a template isn't found in the templates
+// directory: a text page, an index page, a series page, a search page and a 404 page, with the
+// layout and partials they share. Together they are enough to build a site with no templates at
+// all.
+var DefaultTheme = must1(fs.Sub(theme, "theme"))
+
+// DefaultTextTemplate is the template a Text is rendered with if neither it nor its Feed name one.
+var DefaultTextTemplate = "page.html"
+
+// SitePages are the templates rendered once for the whole site, into the public root. The ones in
+// DefaultTheme are only rendered if the site configuration enables ThemePages.
+var SitePages = []string{"search.html", "404.html"}
+
+// SitePageContent is the data SitePages are executed with. Feed is always nil; it's present so
+// layouts shared with Text and index pages can use `{{ with .Feed }}`.
+type SitePageContent struct {
+	Meta *MetaT
+	Site *Site
+	Feed *Feed
+}
+
+// RenderSitePages renders each of SitePages that has a template in the templates directory, or in
+// DefaultTheme if ThemePages is enabled.
+func (g *Generator) RenderSitePages() error {
+	built := g.Site.Built
+	for _, name := range SitePages {
+		if _, ok := g.Templates.Resolve("", name); !ok {
+			continue
+		}
+		if g.Templates.IsThemed(name) && !g.SiteConfigOrDefault().ThemePages {
+			continue
+		}
+		if err := g.Claim("site", name); err != nil {
+			return err
+		}
+		if err := g.Template(nil, name, &SitePageContent{Meta: Meta(), Site: g.Site}, &built, name); err != nil {
+			return fmt.Errorf("cannot render site page %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EjectTheme writes the DefaultTheme templates into dir so they can be customized. Existing files
+// are left alone unless overwrite is true. The paths of the files written are returned.
+func EjectTheme(dir string, overwrite bool) (written []string, err error) {
+	err = fs.WalkDir(DefaultTheme, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(p))
+		if _, err := os.Stat(dst); err == nil && !overwrite {
+			slog.Warn("not overwriting existing template", "file", dst)
+			return nil
+		}
+		b, err := fs.ReadFile(DefaultTheme, p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			return fmt.Errorf("cannot create directory for %q: %w", dst, err)
+		}
+		if err := os.WriteFile(dst, b, 0o644); err != nil {
+			return fmt.Errorf("cannot write %q: %w", dst, err)
+		}
+		written = append(written, dst)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,152 @@
+package enbypub
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlKeyLine matches a top-level `key = value` line, capturing everything up to the value.
+var tomlKeyLine = regexp.MustCompile(`^(\s*("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)\s*=\s*)(.*)$`)
+
+// tomlTableLine matches a table or array-of-tables header.
+var tomlTableLine = regexp.MustCompile(`^\s*\[`)
+
+// tomlEncodeValue returns the TOML encoding of v as it would appear after `key = `.
+func tomlEncodeValue(v any) (string, error) {
+	var B bytes.Buffer
+	if err := toml.NewEncoder(&B).Encode(map[string]any{"v": deref(v)}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(B.String(), "v = ")), nil
+}
+
+// tomlSplitComment separates a single-line TOML value from any trailing comment. ok is false if
+// the value continues onto another line.
+func tomlSplitComment(s string) (value, comment string, ok bool) {
+	if strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, `'''`) {
+		return "", "", false
+	}
+	var quote rune
+	depth := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		case r == '#':
+			return strings.TrimRight(s[:i], " \t"), s[i:], depth == 0
+		}
+	}
+	return strings.TrimRight(s, " \t\r"), "", depth == 0 && quote == 0
+}
+
+// patchTOML sets each of fields as a top-level key in the TOML document src. Keys holding a
+// different single-line value have just that value replaced (keeping any trailing comment), and
+// missing keys are added before the first table. If an existing value spans several lines the
+// whole document is re-encoded instead, which loses comments. Either way, the document keeps its
+// line endings.
+func patchTOML(src []byte, fields ...metadataField) ([]byte, error) {
+	var prims map[string]toml.Primitive
+	md, err := toml.Decode(string(src), &prims)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// top is the number of lines before the first table header
+	top := len(lines)
+	for i := range lines {
+		if tomlTableLine.MatchString(lines[i]) {
+			top = i
+			break
+		}
+	}
+
+	var appended strings.Builder
+	for _, f := range fields {
+		enc, err := tomlEncodeValue(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %q: %w", f.Key, err)
+		}
+		if p, ok := prims[f.Key]; ok {
+			if sameValue(func(v any) error { return md.PrimitiveDecode(p, v) }, f.Value) {
+				continue
+			}
+			replaced := false
+			for i := range lines[:top] {
+				m := tomlKeyLine.FindStringSubmatch(strings.TrimRight(lines[i], "\r\n"))
+				if m == nil || strings.Trim(m[2], `"'`) != f.Key {
+					continue
+				}
+				old, comment, ok := tomlSplitComment(m[3])
+				if !ok {
+					break
+				}
+				// keep literal strings literal if the new value allows it
+				if strings.HasPrefix(old, "'") && strings.HasPrefix(enc, `"`) && !strings.ContainsAny(enc, `\'`) {
+					enc = "'" + strings.Trim(enc, `"`) + "'"
+				}
+				eol := lines[i][len(strings.TrimRight(lines[i], "\r\n")):]
+				nl := m[1] + enc
+				if comment != "" {
+					nl += " " + comment
+				}
+				lines[i] = nl + eol
+				replaced = true
+				break
+			}
+			if !replaced {
+				return tomlReencode(src, fields)
+			}
+			continue
+		}
+		fmt.Fprintf(&appended, "%s = %s\n", f.Key, enc)
+	}
+
+	if appended.Len() > 0 {
+		// insert before any blank lines or comments leading into the first table
+		at := top
+		for at > 0 && top < len(lines) {
+			t := strings.TrimSpace(lines[at-1])
+			if t != "" && !strings.HasPrefix(t, "#") {
+				break
+			}
+			at--
+		}
+		if at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+			lines[at-1] += "\n"
+		}
+		lines = append(lines[:at], append([]string{appended.String()}, lines[at:]...)...)
+	}
+	return withLineEnding([]byte(strings.Join(lines, "")), lineEnding(src)), nil
+}
+
+// tomlReencode sets fields on the decoded document src and encodes it again from scratch.
+func tomlReencode(src []byte, fields []metadataField) ([]byte, error) {
+	var m map[string]any
+	if err := toml.Unmarshal(src, &m); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		m[f.Key] = deref(f.Value)
+	}
+	var B bytes.Buffer
+	if err := toml.NewEncoder(&B).Encode(m); err != nil {
+		return nil, err
+	}
+	return withLineEnding(B.Bytes(), lineEnding(src)), nil
+}
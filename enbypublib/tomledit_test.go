@@ -0,0 +1,116 @@
+package enbypub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchTOML(t *testing.T) {
+	created := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	title := "New"
+	tests := []struct {
+		name   string
+		src    string
+		fields []metadataField
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			src:    "title = 'New' # a comment\ncreated = 2024-03-05T12:00:00Z\n",
+			fields: []metadataField{{"title", &title}, {"created", &created}},
+			want:   "title = 'New' # a comment\ncreated = 2024-03-05T12:00:00Z\n",
+		},
+		{
+			name:   "comments",
+			src:    "# about this text\ntitle = \"Old\" # was a draft\ntags = [\"a\", \"b\"] # kept\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "# about this text\ntitle = \"New\" # was a draft\ntags = [\"a\", \"b\"] # kept\n",
+		},
+		{
+			name:   "literal string",
+			src:    "title = 'Old'\n",
+			fields: []metadataField{{"title", `C:\new`}},
+			want:   "title = \"C:\\\\new\"\n",
+		},
+		{
+			name:   "literal string kept",
+			src:    "title = 'Old'\n",
+			fields: []metadataField{{"title", "new # not a comment"}},
+			want:   "title = 'new # not a comment'\n",
+		},
+		{
+			name:   "quoted key",
+			src:    "\"title\" = \"Old\"\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "\"title\" = \"New\"\n",
+		},
+		{
+			name:   "value with a hash",
+			src:    "title = \"Old #1\" # note\n",
+			fields: []metadataField{{"title", "New #2"}},
+			want:   "title = \"New #2\" # note\n",
+		},
+		{
+			name:   "missing keys before tables",
+			src:    "title = \"New\"\n\n# the author\n[author]\nname = \"Someone\"\n",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}, {"created", &created}},
+			want:   "title = \"New\"\nslug = \"new\"\ncreated = 2024-03-05T12:00:00Z\n\n# the author\n[author]\nname = \"Someone\"\n",
+		},
+		{
+			name:   "missing keys at the end",
+			src:    "title = \"New\"\n# trailing comment\n",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "title = \"New\"\n# trailing comment\nslug = \"new\"\n",
+		},
+		{
+			name:   "missing final newline",
+			src:    "title = \"New\"",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "title = \"New\"\nslug = \"new\"\n",
+		},
+		{
+			name:   "empty",
+			src:    "",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "slug = \"new\"\n",
+		},
+		{
+			name:   "same key in a table",
+			src:    "[author]\ntitle = \"Dr\"\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "title = \"New\"\n[author]\ntitle = \"Dr\"\n",
+		},
+		{
+			name:   "crlf",
+			src:    "title = \"Old\" # keep\r\ntags = [\"a\"]\r\n",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}},
+			want:   "title = \"New\" # keep\r\ntags = [\"a\"]\r\nslug = \"new\"\r\n",
+		},
+		{
+			name:   "re-encode multiline value",
+			src:    "# lost\ntitle = \"\"\"\nOld\ntitle\"\"\"\nslug = \"old\"\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "slug = \"old\"\ntitle = \"New\"\n",
+		},
+		{
+			name:   "re-encode crlf",
+			src:    "title = '''\r\nOld'''\r\nslug = \"old\"\r\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "slug = \"old\"\r\ntitle = \"New\"\r\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := patchTOML([]byte(tt.src), tt.fields...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: patched\n%q\nto\n%q\nwant\n%q", tt.name, tt.src, got, tt.want)
+		}
+	}
+
+	if got, err := patchTOML([]byte("title = \n"), metadataField{"slug", "x"}); err == nil {
+		t.Errorf("patched invalid TOML to %q; want an error", got)
+	}
+}
@@ -0,0 +1,52 @@
+package enbypub
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A URLStyle decides how the last canonical path component of a Text becomes its output file,
+// and how the Text is linked to.
+type URLStyle string
+
+const (
+	// URLStyleFile publishes a Text as "slug.html", linked as "slug.html". It's the default.
+	URLStyleFile URLStyle = "file"
+
+	// URLStyleDirectory publishes a Text as "slug/index.html", linked as "slug/", so its URL
+	// doesn't reveal how the site is built
+	URLStyleDirectory URLStyle = "directory"
+
+	// URLStyleExtensionless publishes a Text as "slug", linked as "slug". The web server must be
+	// configured to serve files without an extension as text/html.
+	URLStyleExtensionless URLStyle = "extensionless"
+)
+
+// UnmarshalText sets s from a style name.
+func (s *URLStyle) UnmarshalText(b []byte) error {
+	switch v := URLStyle(b); v {
+	case URLStyleFile, URLStyleDirectory, URLStyleExtensionless:
+		*s = v
+		return nil
+	}
+	return fmt.Errorf("unknown url style %q (expected %q, %q or %q)", b, URLStyleFile, URLStyleDirectory, URLStyleExtensionless)
+}
+
+// filename returns the output file for a Text whose last canonical path component is name.
+func (s URLStyle) filename(name string) string {
+	switch s {
+	case URLStyleDirectory:
+		return name + "/index.html"
+	case URLStyleExtensionless:
+		return name
+	}
+	return name + ".html"
+}
+
+// url returns the path a Text published at the output path p is linked as.
+func (s URLStyle) url(p string) string {
+	if s == URLStyleDirectory && (p == "index.html" || strings.HasSuffix(p, "/index.html")) {
+		return strings.TrimSuffix(p, "index.html")
+	}
+	return p
+}
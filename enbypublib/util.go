@@ -1,6 +1,10 @@
 package enbypub
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
 
 func must1[T any](v T, err error) T {
 	if err != nil {
@@ -12,3 +16,30 @@ func must1[T any](v T, err error) T {
 func strptr(s string) *string {
 	return &s
 }
+
+// deref follows any pointers in v and returns the value they point to. Some encoders (eg yaml.v3
+// for *time.Time) don't cope with pointers to otherwise supported types.
+func deref(v any) any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv.Interface()
+}
+
+// sameValue reports whether decode produces a value equal to v when given a pointer to a new
+// value of v's type.
+func sameValue(decode func(any) error, v any) bool {
+	rv := reflect.ValueOf(deref(v))
+	if !rv.IsValid() || rv.Kind() == reflect.Pointer {
+		return false
+	}
+	dec := reflect.New(rv.Type())
+	if err := decode(dec.Interface()); err != nil {
+		return false
+	}
+	if t, ok := rv.Interface().(time.Time); ok {
+		return t.Equal(dec.Elem().Interface().(time.Time))
+	}
+	return reflect.DeepEqual(rv.Interface(), dec.Elem().Interface())
+}
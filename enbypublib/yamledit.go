@@ -0,0 +1,274 @@
+package enbypub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// metadataField is a single key and value to be set in a metadata document.
+type metadataField struct {
+	Key   string
+	Value any
+}
+
+// errYAMLNotPatchable is returned internally when a document can't be edited line by line.
+var errYAMLNotPatchable = errors.New("document cannot be patched in place")
+
+// patchYAML sets each of fields on the mapping found by following path (a list of mapping keys)
+// from the document root. Keys that already hold an equal value are left alone, keys holding a
+// different scalar value have just that value replaced, and missing keys are appended to the end
+// of the mapping. Everything else in src, including comments, blank lines, key order and quoting
+// style, is preserved byte for byte.
+//
+// If the document is laid out in a way that can't be edited line by line (eg flow mappings or
+// multi-line scalars that must change), it is instead re-encoded from its parsed node tree, which
+// still preserves comments, key order and quoting style but may normalize whitespace. Either way,
+// the document keeps its line endings.
+func patchYAML(src []byte, path []string, fields ...metadataField) ([]byte, error) {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		// an empty document is patched by simply appending the fields
+		if len(path) > 0 {
+			return nil, fmt.Errorf("cannot find %q in an empty document", strings.Join(path, "."))
+		}
+		var B bytes.Buffer
+		B.Write(src)
+		if len(src) > 0 && !bytes.HasSuffix(src, []byte("\n")) {
+			B.WriteByte('\n')
+		}
+		for _, f := range fields {
+			s, err := yamlEncodeField(f, "")
+			if err != nil {
+				return nil, err
+			}
+			B.WriteString(s)
+		}
+		return withLineEnding(B.Bytes(), lineEnding(src)), nil
+	}
+
+	m := doc.Content[0]
+	var parents []*yaml3.Node
+	for _, k := range path {
+		if m.Kind != yaml3.MappingNode {
+			return nil, fmt.Errorf("cannot find %q: %q is not a mapping", strings.Join(path, "."), k)
+		}
+		_, v := yamlLookup(m, k)
+		if v == nil {
+			return nil, fmt.Errorf("cannot find %q: no key %q", strings.Join(path, "."), k)
+		}
+		parents = append(parents, m)
+		m = v
+	}
+	if m.Kind != yaml3.MappingNode {
+		return nil, fmt.Errorf("cannot set fields on %q: not a mapping", strings.Join(path, "."))
+	}
+
+	out, err := yamlPatchLines(src, m, parents, fields)
+	if errors.Is(err, errYAMLNotPatchable) {
+		out, err = yamlPatchNodes(&doc, m, fields)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return withLineEnding(out, lineEnding(src)), nil
+}
+
+// lineEnding returns the line ending used in src: "\r\n" if its first line ends with one,
+// otherwise "\n".
+func lineEnding(src []byte) string {
+	if i := bytes.IndexByte(src, '\n'); i > 0 && src[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// withLineEnding returns b with every line ending in eol, so that lines added to a document
+// match the ones already there.
+func withLineEnding(b []byte, eol string) []byte {
+	if eol == "\n" {
+		return b
+	}
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\n"), []byte(eol))
+}
+
+// yamlLookup returns the key and value nodes for key in mapping m, or nils.
+func yamlLookup(m *yaml3.Node, key string) (k, v *yaml3.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlScalarNode encodes v as a scalar node, keeping the quoting style of orig if it had one.
+func yamlScalarNode(v any, orig *yaml3.Node) (*yaml3.Node, error) {
+	var n yaml3.Node
+	if err := n.Encode(deref(v)); err != nil {
+		return nil, err
+	}
+	if n.Kind != yaml3.ScalarNode {
+		return nil, errYAMLNotPatchable
+	}
+	if orig != nil && n.Tag == "!!str" && orig.Style&(yaml3.DoubleQuotedStyle|yaml3.SingleQuotedStyle) != 0 {
+		n.Style = orig.Style & (yaml3.DoubleQuotedStyle | yaml3.SingleQuotedStyle)
+	}
+	return &n, nil
+}
+
+// yamlEncodeField renders a single `key: value` pair (with a trailing newline) at indent.
+func yamlEncodeField(f metadataField, indent string) (string, error) {
+	var B bytes.Buffer
+	e := yaml3.NewEncoder(&B)
+	e.SetIndent(2)
+	if err := e.Encode(map[string]any{f.Key: deref(f.Value)}); err != nil {
+		return "", fmt.Errorf("cannot encode %q: %w", f.Key, err)
+	}
+	e.Close()
+	lines := strings.SplitAfter(B.String(), "\n")
+	for i := range lines {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// yamlLastLine returns the last (1-based) line occupied by n or any of its children.
+func yamlLastLine(n *yaml3.Node) int {
+	l := n.Line
+	if n.Kind == yaml3.ScalarNode && (n.Style&(yaml3.LiteralStyle|yaml3.FoldedStyle)) != 0 {
+		l += strings.Count(strings.TrimRight(n.Value, "\n"), "\n") + 1
+	}
+	for _, c := range n.Content {
+		if cl := yamlLastLine(c); cl > l {
+			l = cl
+		}
+	}
+	return l
+}
+
+// yamlNextLine returns the (1-based) line of whatever follows m in the document, or 0 if m is
+// the last thing in the document. parents lists the mappings enclosing m, outermost first.
+func yamlNextLine(m *yaml3.Node, parents []*yaml3.Node) int {
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		for j := 1; j < len(p.Content); j += 2 {
+			if p.Content[j] == m && j+1 < len(p.Content) {
+				return p.Content[j+1].Line
+			}
+		}
+		m = p
+	}
+	return 0
+}
+
+func yamlPatchLines(src []byte, m *yaml3.Node, parents []*yaml3.Node, fields []metadataField) ([]byte, error) {
+	if m.Style&yaml3.FlowStyle != 0 || len(m.Content) == 0 {
+		return nil, errYAMLNotPatchable
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	indent := strings.Repeat(" ", m.Content[0].Column-1)
+
+	var appended strings.Builder
+	for _, f := range fields {
+		k, v := yamlLookup(m, f.Key)
+		if v == nil {
+			s, err := yamlEncodeField(f, indent)
+			if err != nil {
+				return nil, err
+			}
+			appended.WriteString(s)
+			continue
+		}
+		if v.Kind == yaml3.ScalarNode && sameValue(v.Decode, f.Value) {
+			continue
+		}
+		if v.Kind != yaml3.ScalarNode || v.Line != k.Line || strings.Contains(v.Value, "\n") ||
+			v.Style&(yaml3.LiteralStyle|yaml3.FoldedStyle) != 0 {
+			return nil, errYAMLNotPatchable
+		}
+		n, err := yamlScalarNode(f.Value, v)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := yaml3.Marshal(n)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %q: %w", f.Key, err)
+		}
+		line := lines[v.Line-1]
+		eol := line[len(strings.TrimRight(line, "\r\n")):]
+		// yaml.v3 reports columns in runes
+		col := len(string([]rune(line)[:v.Column-1]))
+		nl := line[:col] + strings.TrimRight(string(enc), "\n")
+		if v.LineComment != "" {
+			nl += " " + v.LineComment
+		}
+		lines[v.Line-1] = nl + eol
+	}
+
+	if appended.Len() > 0 {
+		// insert after the last line of m, but before any blank lines or comments that lead into
+		// whatever follows m
+		at := len(lines)
+		if next := yamlNextLine(m, parents); next > 0 {
+			at = next - 1
+		}
+		last := yamlLastLine(m)
+		for at > last {
+			t := strings.TrimSpace(lines[at-1])
+			if t != "" && !strings.HasPrefix(t, "#") {
+				break
+			}
+			at--
+		}
+		if at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+			lines[at-1] += "\n"
+		}
+		lines = append(lines[:at], append([]string{appended.String()}, lines[at:]...)...)
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+func yamlPatchNodes(doc *yaml3.Node, m *yaml3.Node, fields []metadataField) ([]byte, error) {
+	for _, f := range fields {
+		_, v := yamlLookup(m, f.Key)
+		if v != nil && v.Kind == yaml3.ScalarNode && sameValue(v.Decode, f.Value) {
+			continue
+		}
+		var n yaml3.Node
+		if err := n.Encode(deref(f.Value)); err != nil {
+			return nil, fmt.Errorf("cannot encode %q: %w", f.Key, err)
+		}
+		if v == nil {
+			m.Content = append(m.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!str", Value: f.Key}, &n)
+			continue
+		}
+		if sn, err := yamlScalarNode(f.Value, v); err == nil {
+			n = *sn
+		}
+		n.HeadComment, n.LineComment, n.FootComment = v.HeadComment, v.LineComment, v.FootComment
+		*v = n
+	}
+	var B bytes.Buffer
+	e := yaml3.NewEncoder(&B)
+	e.SetIndent(2)
+	if err := e.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return B.Bytes(), nil
+}
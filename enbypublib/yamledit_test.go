@@ -0,0 +1,139 @@
+package enbypub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchYAML(t *testing.T) {
+	created := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	title := "New"
+	tests := []struct {
+		name   string
+		src    string
+		path   []string
+		fields []metadataField
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			src:    "title: New # a comment\ncreated: 2024-03-05T12:00:00Z\n",
+			fields: []metadataField{{"title", &title}, {"created", &created}},
+			want:   "title: New # a comment\ncreated: 2024-03-05T12:00:00Z\n",
+		},
+		{
+			name:   "comments",
+			src:    "# about this text\ntitle: Old # was a draft\n\n# where it goes\ntags: [a, b] # flow lists are kept\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "# about this text\ntitle: New # was a draft\n\n# where it goes\ntags: [a, b] # flow lists are kept\n",
+		},
+		{
+			name:   "double quoted",
+			src:    "title: \"Old\"\nslug: old\n",
+			fields: []metadataField{{"title", `say "hi"`}},
+			want:   "title: \"say \\\"hi\\\"\"\nslug: old\n",
+		},
+		{
+			name:   "single quoted",
+			src:    "title: 'Old'\n",
+			fields: []metadataField{{"title", "it's new"}},
+			want:   "title: 'it''s new'\n",
+		},
+		{
+			name:   "needs quoting",
+			src:    "title: Old\n",
+			fields: []metadataField{{"title", "yes: really"}},
+			want:   "title: 'yes: really'\n",
+		},
+		{
+			name:   "unicode",
+			src:    "größe: Old\nslug: old\n",
+			fields: []metadataField{{"größe", "Neu"}},
+			want:   "größe: Neu\nslug: old\n",
+		},
+		{
+			name:   "multiline value kept",
+			src:    "summary: |\n  line one\n  line two\ntitle: Old\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "summary: |\n  line one\n  line two\ntitle: New\n",
+		},
+		{
+			name:   "missing keys",
+			src:    "title: New\ntags:\n  - a\n  - b\n\n# trailing comment\n",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}, {"created", &created}},
+			want:   "title: New\ntags:\n  - a\n  - b\nslug: new\ncreated: 2024-03-05T12:00:00Z\n\n# trailing comment\n",
+		},
+		{
+			name:   "missing final newline",
+			src:    "title: New",
+			fields: []metadataField{{"slug", "new"}},
+			want:   "title: New\nslug: new\n",
+		},
+		{
+			name:   "empty",
+			src:    "",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}},
+			want:   "title: New\nslug: new\n",
+		},
+		{
+			name:   "crlf",
+			src:    "title: Old # keep\r\ntags: [a]\r\n",
+			fields: []metadataField{{"title", &title}, {"slug", "new"}},
+			want:   "title: New # keep\r\ntags: [a]\r\nslug: new\r\n",
+		},
+		{
+			name:   "nested",
+			src:    "public:\n  tags: [public]\n\n# the next feed\nprivate:\n  tags: [private]\n",
+			path:   []string{"public"},
+			fields: []metadataField{{"id", "abc"}, {"slug", "public"}},
+			want:   "public:\n  tags: [public]\n  id: abc\n  slug: public\n\n# the next feed\nprivate:\n  tags: [private]\n",
+		},
+		{
+			name:   "re-encode flow mapping",
+			src:    "# front matter\n{title: Old, slug: old}\n",
+			fields: []metadataField{{"title", &title}, {"created", &created}},
+			want:   "# front matter\n{title: New, slug: old, created: '2024-03-05T12:00:00Z'}\n",
+		},
+		{
+			name:   "re-encode multiline value",
+			src:    "title: |\n  Old\n  title\nslug: old # keep\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "title: New\nslug: old # keep\n",
+		},
+		{
+			name:   "re-encode crlf",
+			src:    "title: >\r\n  Old\r\nslug: old\r\n",
+			fields: []metadataField{{"title", &title}},
+			want:   "title: New\r\nslug: old\r\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := patchYAML([]byte(tt.src), tt.path, tt.fields...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: patched\n%q\nto\n%q\nwant\n%q", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestPatchYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		path []string
+	}{
+		{"invalid", "title: [unterminated\n", nil},
+		{"not a mapping", "- a\n- b\n", nil},
+		{"missing path", "public:\n  tags: [a]\n", []string{"private"}},
+		{"path in empty document", "", []string{"public"}},
+		{"path through a scalar", "public: yes\n", []string{"public"}},
+	}
+	for _, tt := range tests {
+		if got, err := patchYAML([]byte(tt.src), tt.path, metadataField{"slug", "x"}); err == nil {
+			t.Errorf("%s: patched %q to %q; want an error", tt.name, tt.src, got)
+		}
+	}
+}
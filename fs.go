@@ -9,6 +9,24 @@ import (
 )
 
 func WalkContent() (enbypub.Texts, error) {
+	files, err := ContentFiles()
+	if err != nil {
+		return nil, err
+	}
+	T := make(enbypub.Texts)
+	for i := range files {
+		t, err := enbypub.LoadTextFromFile(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("encountered an error while scanning content directory %q: %w", args.ContentDir, err)
+		}
+		T[*t.Id] = t
+	}
+	return T, nil
+}
+
+// ContentFiles returns the path of every Text file in the content folder, including those inside
+// page bundles: they're Texts of their own, never resources of the bundle.
+func ContentFiles() ([]string, error) {
 	files := []string{}
 	err := fs.WalkDir(rootDir, args.ContentDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -25,15 +43,7 @@ func WalkContent() (enbypub.Texts, error) {
 	if err != nil {
 		return nil, fmt.Errorf("encountered an error while walking content directory %q: %w", args.ContentDir, err)
 	}
-	T := make(enbypub.Texts)
-	for i := range files {
-		t, err := enbypub.LoadTextFromFile(files[i])
-		if err != nil {
-			return nil, fmt.Errorf("encountered an error while scanning content directory %q: %w", args.ContentDir, err)
-		}
-		T[*t.Id] = t
-	}
-	return T, nil
+	return files, nil
 }
 
 func EnsurePath(fs *enbypub.FeedStructure) error {
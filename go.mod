@@ -3,11 +3,14 @@ module github.com/ironiridis/enbypub
 go 1.22.0
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/alexflint/go-arg v1.4.3
 	github.com/google/uuid v1.6.0
 	github.com/yuin/goldmark v1.7.0
+	golang.org/x/image v0.15.0
 	golang.org/x/text v0.14.0
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/alexflint/go-scalar v1.1.0 // indirect
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	enbypub "github.com/ironiridis/enbypub/enbypublib"
+)
+
+// listFormats are the output formats of list.
+var listFormats = []string{"table", "json", "csv"}
+
+// A listing describes one Text for list.
+type listing struct {
+	Id        string        `json:"id"`
+	Title     string        `json:"title"`
+	Tags      []string      `json:"tags"`
+	Created   time.Time     `json:"created"`
+	Modified  time.Time     `json:"modified"`
+	Draft     bool          `json:"draft"`
+	File      string        `json:"file"`
+	Published []publication `json:"published"`
+}
+
+// A publication is a Feed a Text is published in, and its URL there. Texts in Feeds without a
+// CanonicalPath have no URL.
+type publication struct {
+	Feed string `json:"feed"`
+	URL  string `json:"url,omitempty"`
+}
+
+func (p publication) String() string {
+	if p.URL == "" {
+		return p.Feed
+	}
+	return p.Feed + " " + p.URL
+}
+
+// list writes every Text that passes the filters of cmd (and satisfies m, if set), newest first,
+// with the Feeds it's published in and its URL in each. Nothing is written to the content or
+// public folders.
+func list(cmd *ListCmd, m *enbypub.Match) error {
+	P, err := loadReadOnly()
+	if err != nil {
+		return err
+	}
+
+	// Feed slug and URL of each Text, from the structure each Feed publishes
+	published := make(map[*enbypub.Text][]publication)
+	for _, F := range P.Feeds {
+		if len(F.CanonicalPath) == 0 {
+			for _, T := range F.Index {
+				published[T] = append(published[T], publication{Feed: *F.Slug})
+			}
+			continue
+		}
+		CS, err := F.CanonicalStructure()
+		if err != nil {
+			return err
+		}
+		for p, T := range CS.Files {
+			url := "/" + CS.URL(p)
+			if b := P.Generator.BaseURL; b != nil {
+				url = b.JoinPath(CS.URL(p)).String()
+			}
+			published[T] = append(published[T], publication{Feed: *F.Slug, URL: url})
+		}
+	}
+
+	var ls []listing
+	for _, T := range P.Generator.Site.Texts {
+		pubs := published[T]
+		slices.SortFunc(pubs, func(a, b publication) int { return strings.Compare(a.String(), b.String()) })
+		if !cmd.includes(T, pubs) || (m != nil && !m.Matches(T)) {
+			continue
+		}
+		l := listing{
+			Id:        T.Id.String(),
+			Tags:      T.Tags,
+			Created:   T.Created.In(enbypub.Timezone),
+			Draft:     T.IsDraft(),
+			File:      T.SourceFile(),
+			Published: pubs,
+		}
+		if T.Title != nil {
+			l.Title = *T.Title
+		}
+		if T.Modified != nil {
+			l.Modified = T.Modified.In(enbypub.Timezone)
+		}
+		if l.Tags == nil {
+			l.Tags = []string{}
+		}
+		if l.Published == nil {
+			l.Published = []publication{}
+		}
+		ls = append(ls, l)
+	}
+
+	slices.SortFunc(ls, func(a, b listing) int {
+		return cmp.Or(b.Created.Compare(a.Created), strings.Compare(a.File, b.File))
+	})
+
+	switch cmd.Format {
+	case "json":
+		return writeListJSON(os.Stdout, ls)
+	case "csv":
+		return writeListCSV(os.Stdout, ls)
+	}
+	return writeListTable(os.Stdout, ls)
+}
+
+// includes reports whether T, published as pubs, passes the filters of cmd.
+func (cmd *ListCmd) includes(T *enbypub.Text, pubs []publication) bool {
+	if len(cmd.Tags) > 0 && !T.IsTagged(cmd.Tags...) {
+		return false
+	}
+	if len(cmd.Feeds) > 0 && !slices.ContainsFunc(pubs, func(p publication) bool { return slices.Contains(cmd.Feeds, p.Feed) }) {
+		return false
+	}
+	if cmd.Since != nil && T.Created.Before(cmd.Since.Time) {
+		return false
+	}
+	if cmd.Until != nil {
+		until := cmd.Until.Time
+		if cmd.Until.day {
+			until = until.AddDate(0, 0, 1)
+			if !T.Created.Before(until) {
+				return false
+			}
+		} else if T.Created.After(until) {
+			return false
+		}
+	}
+	if cmd.Drafts && !T.IsDraft() || cmd.NoDrafts && T.IsDraft() {
+		return false
+	}
+	return true
+}
+
+func writeListTable(w io.Writer, ls []listing) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tMODIFIED\tTITLE\tTAGS\tPUBLISHED")
+	for _, l := range ls {
+		pubs := make([]string, len(l.Published))
+		for i := range l.Published {
+			pubs[i] = l.Published[i].String()
+		}
+		title := l.Title
+		if l.Draft {
+			title += " (draft)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", l.Id, l.Created.Format(time.DateOnly), l.Modified.Format(time.DateOnly),
+			title, strings.Join(l.Tags, ","), strings.Join(pubs, ", "))
+	}
+	return tw.Flush()
+}
+
+func writeListJSON(w io.Writer, ls []listing) error {
+	if ls == nil {
+		ls = []listing{}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(ls)
+}
+
+// writeListCSV writes a row for each publication of each Text, or a single row without a feed for
+// a Text that isn't published, so each row has one URL.
+func writeListCSV(w io.Writer, ls []listing) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "tags", "created", "modified", "draft", "file", "feed", "url"})
+	for _, l := range ls {
+		row := []string{l.Id, l.Title, strings.Join(l.Tags, ","), l.Created.Format(time.RFC3339), l.Modified.Format(time.RFC3339),
+			fmt.Sprint(l.Draft), l.File}
+		if len(l.Published) == 0 {
+			cw.Write(append(row, "", ""))
+		}
+		for _, p := range l.Published {
+			cw.Write(append(slices.Clip(row), p.Feed, p.URL))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
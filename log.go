@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// logHandler writes log records as single human readable lines, eg
+// `warning: unlikely file modification time file=content/a.md`.
+type logHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newLogHandler(w io.Writer, level slog.Leveler) *logHandler {
+	return &logHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *logHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var B strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		B.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		B.WriteString("warning: ")
+	}
+	B.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		fmt.Fprintf(&B, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	B.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, B.String())
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	n := *h
+	n.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &n
+}
+
+// WithGroup is not supported; grouped attributes are written without their group name.
+func (h *logHandler) WithGroup(string) slog.Handler {
+	return h
+}
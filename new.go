@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	enbypub "github.com/ironiridis/enbypub/enbypublib"
+)
+
+// newText creates a Text in the content folder from the archetype that best suits its tags and
+// feeds, with its metadata already assigned, and optionally opens it in an editor.
+func newText(cmd *NewCmd) error {
+	var tags []string
+	for _, t := range cmd.Tags {
+		for _, tag := range strings.Split(t, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	d := enbypub.NewArchetypeData(cmd.Title, tags)
+
+	feeds, defaultTemplate, err := newTextFeeds(d)
+	if err != nil {
+		return err
+	}
+	d.Template = cmd.Template
+	if d.Template == "" {
+		d.Template = defaultTemplate
+	}
+
+	archetype, ext := enbypub.DefaultArchetype, ".md"
+	dir := filepath.Join(args.Root, cmd.Archetypes)
+	if _, err := os.Stat(dir); err == nil {
+		name, err := enbypub.FindArchetype(os.DirFS(dir), tags, feeds)
+		if err != nil {
+			return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: dir, Err: err}
+		}
+		if name != "" {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: filepath.Join(dir, name), Err: err}
+			}
+			archetype, ext = string(b), path.Ext(name)
+			slog.Debug("using archetype " + filepath.Join(dir, name))
+		}
+	}
+	content, err := enbypub.NewTextFromArchetype(archetype, d)
+	if err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindConfig, File: filepath.Join(dir, "*"+ext), Err: err}
+	}
+
+	fn := filepath.Join(args.Root, args.ContentDir, d.Slug+ext)
+	if err := os.MkdirAll(filepath.Dir(fn), 0777); err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: filepath.Dir(fn), Err: err}
+	}
+	fp, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindContent, File: fn, Err: errors.New("a text with this slug already exists")}
+	} else if err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: fn, Err: err}
+	}
+	fp.Write(content)
+	if err := fp.Close(); err != nil {
+		return &enbypub.SourceError{Kind: enbypub.ErrorKindIO, File: fn, Err: err}
+	}
+	// loading the new Text assigns its checksum and modification time
+	if _, err := enbypub.LoadTextFromFile(fn); err != nil {
+		return err
+	}
+	slog.Info("created " + fn)
+
+	if cmd.Edit {
+		return edit(fn)
+	}
+	return nil
+}
+
+// newTextFeeds returns the slugs of the Feeds a new Text described by d would be published in, and
+// the DefaultTemplate of the first of those that has one (or enbypub.DefaultTextTemplate).
+func newTextFeeds(d *enbypub.ArchetypeData) (slugs []string, template string, err error) {
+	template = enbypub.DefaultTextTemplate
+	if _, err := os.Stat(args.FeedsYaml); errors.Is(err, fs.ErrNotExist) {
+		return nil, template, nil
+	}
+	F, err := enbypub.ReadFeedsFromFile(args.FeedsYaml)
+	if err != nil {
+		return nil, "", err
+	}
+	T := &enbypub.Text{Title: &d.Title, Tags: d.Tags}
+	var included []*enbypub.Feed
+	for _, f := range F {
+		if f.Includes(T) {
+			included = append(included, f)
+		}
+	}
+	slices.SortFunc(included, func(a, b *enbypub.Feed) int { return strings.Compare(*a.Slug, *b.Slug) })
+	for _, f := range included {
+		slugs = append(slugs, *f.Slug)
+	}
+	for _, f := range included {
+		if f.DefaultTemplate != nil {
+			return slugs, *f.DefaultTemplate, nil
+		}
+	}
+	return slugs, template, nil
+}
+
+// edit opens fn with the editor named by $VISUAL or $EDITOR, which may include arguments.
+func edit(fn string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	argv := strings.Fields(editor)
+	if len(argv) == 0 {
+		return fmt.Errorf("cannot open %q: neither $VISUAL nor $EDITOR is set", fn)
+	}
+	c := exec.Command(argv[0], append(argv[1:], fn)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("cannot run editor %q: %w", editor, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// serve builds the site (unless told not to) and serves the public folder until interrupted.
+// Requests for missing files get the site's 404.html, if there is one.
+func serve(cmd *ServeCmd) error {
+	if !cmd.NoBuild {
+		if err := build(); err != nil {
+			return err
+		}
+	}
+	public := http.Dir(args.PublicDir)
+	files := http.FileServer(public)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Debug(r.Method + " " + r.URL.Path)
+		f, err := public.Open(path.Clean(r.URL.Path))
+		if err == nil {
+			f.Close()
+			files.ServeHTTP(w, r)
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nf, err := os.ReadFile(filepath.Join(args.PublicDir, "404.html"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(nf)
+	})
+	slog.Info("serving " + args.PublicDir + " at http://" + cmd.Listen + "/")
+	if err := http.ListenAndServe(cmd.Listen, handler); err != nil {
+		return fmt.Errorf("cannot serve: %w", err)
+	}
+	return nil
+}